@@ -29,13 +29,15 @@ require (
 	github.com/lib/pq v1.0.0
 	github.com/mattn/go-colorable v0.1.0
 	github.com/mattn/go-isatty v0.0.4
+	github.com/mattn/go-sqlite3 v1.10.0
 	github.com/mdempsky/gocode v0.0.0-20181127203757-525aa8bb282c // indirect
 	github.com/nicksnyder/go-i18n v1.10.0 // indirect
 	github.com/pelletier/go-toml v1.2.0 // indirect
 	github.com/peterh/liner v1.1.0 // indirect
 	github.com/pkg/errors v0.8.1
+	github.com/prometheus/client_golang v0.9.2
 	github.com/prometheus/client_model v0.0.0-20190129233127-fd36f4220a90 // indirect
-	github.com/prometheus/common v0.2.0 // indirect
+	github.com/prometheus/common v0.2.0
 	github.com/prometheus/procfs v0.0.0-20190203183350-488faf799f86 // indirect
 	github.com/rogpeppe/godef v1.0.0 // indirect
 	github.com/satori/go.uuid v1.2.0
@@ -45,7 +47,7 @@ require (
 	github.com/stellar/go v0.0.0-20190206192848-6249bdb13e61
 	github.com/stellar/go-xdr v0.0.0-20180917104419-0bc96f33a18e
 	github.com/stretchr/testify v1.3.0
-	github.com/syndtr/goleveldb v0.0.0-20190203031304-2f17a3356c66 // indirect
+	github.com/syndtr/goleveldb v0.0.0-20190203031304-2f17a3356c66
 	github.com/vmihailenco/msgpack v4.0.2+incompatible // indirect
 	github.com/zmb3/gogetdoc v0.0.0-20181120020305-71611d8dcf25 // indirect
 	golang.org/x/arch v0.0.0-20181203225421-5a4828bb7045 // indirect
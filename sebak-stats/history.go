@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"boscoin.io/sebak/lib/block"
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/transaction/operation"
+)
+
+var historyHeader = `# block height, total supply, circulating supply, frozen amount, block inflation, pf inflation, holders`
+
+// HistoryRow is the stats at the block height in the history file.
+type HistoryRow struct {
+	Height         uint64
+	Total          common.Amount
+	Circulating    common.Amount
+	Frozen         common.Amount
+	BlockInflation common.Amount
+	PFInflation    common.Amount
+	Holders        int
+}
+
+func NewHistoryRowFromStats(stats *Stats) HistoryRow {
+	return HistoryRow{
+		Height:         stats.Height,
+		Total:          common.Amount(stats.Total),
+		Circulating:    common.Amount(stats.Circulating),
+		Frozen:         stats.FrozenAmount,
+		BlockInflation: stats.Inflation[operation.TypeInflation],
+		PFInflation:    stats.Inflation[operation.TypeInflationPF],
+		Holders:        len(stats.AccountsByBalance),
+	}
+}
+
+func (h HistoryRow) String() string {
+	return fmt.Sprintf(
+		"%d,%s,%s,%s,%s,%s,%d",
+		h.Height,
+		gonToBOS(h.Total),
+		gonToBOS(h.Circulating),
+		gonToBOS(h.Frozen),
+		gonToBOS(h.BlockInflation),
+		gonToBOS(h.PFInflation),
+		h.Holders,
+	)
+}
+
+// lastHistoryHeight returns the block height of the last row.
+func lastHistoryHeight(b string) (uint64, error) {
+	l := parseCSV(b)
+	if len(l) < 1 {
+		return 0, nil
+	}
+
+	return strconv.ParseUint(l[len(l)-1][0], 10, 64)
+}
+
+// appendHistory appends the row to the published history; the row, which is
+// not newer than the last row is ignored. If the published history can not be
+// read, the history is not updated not to lose the previous rows.
+func appendHistory(row HistoryRow) {
+	body := historyHeader
+	b, err := publisher.Get(historyFile)
+	if err == errNotPublished {
+		log.Debug("history not found; new history is created")
+	} else if err != nil {
+		log.Error("failed to download history from publisher; history is not updated", "error", err)
+		return
+	} else {
+		body = strings.TrimRight(string(b), "\n")
+
+		height, err := lastHistoryHeight(body)
+		if err != nil {
+			log.Error("invalid history; history is not updated", "error", err)
+			return
+		} else if height >= row.Height {
+			log.Debug("history already has the block height", "height", row.Height, "last", height)
+			return
+		}
+	}
+
+	publish(historyFile, []byte(body+"\n"+row.String()+"\n"))
+}
+
+// Replay replays the operations of blocks from genesis to calculate the
+// balances of accounts at each block height. The fee is deducted from the
+// source of transaction and collected to the common account by the proposer
+// transaction.
+type Replay struct {
+	balances map[string]common.Amount
+	// linked are the frozen accounts with their linked account.
+	linked map[string]string
+	// unfreezing is the block height of the last unfreezing request.
+	unfreezing map[string]uint64
+	inflation  map[operation.OperationType]common.Amount
+}
+
+func NewReplay() *Replay {
+	return &Replay{
+		balances:   map[string]common.Amount{},
+		linked:     map[string]string{},
+		unfreezing: map[string]uint64{},
+		inflation:  map[operation.OperationType]common.Amount{},
+	}
+}
+
+func (r *Replay) add(address string, amount common.Amount) (err error) {
+	r.balances[address], err = r.balances[address].Add(amount)
+	return
+}
+
+func (r *Replay) sub(address string, amount common.Amount) (err error) {
+	if r.balances[address], err = r.balances[address].Sub(amount); err != nil {
+		return fmt.Errorf("insufficient balance of %s: %v", address, err)
+	}
+
+	return nil
+}
+
+// operation applies the operation; in genesis block, the accounts are created
+// without source.
+func (r *Replay) operation(height uint64, source string, op operation.Operation) error {
+	switch op.H.Type {
+	case operation.TypeCreateAccount:
+		ca := op.B.(operation.CreateAccount)
+		if height != common.GenesisBlockHeight {
+			if err := r.sub(source, ca.GetAmount()); err != nil {
+				return err
+			}
+		}
+		if len(ca.Linked) > 0 {
+			r.linked[ca.TargetAddress()] = ca.Linked
+		}
+		return r.add(ca.TargetAddress(), ca.GetAmount())
+	case operation.TypePayment:
+		amount := op.B.(operation.Payable).GetAmount()
+		if err := r.sub(source, amount); err != nil {
+			return err
+		}
+		return r.add(op.B.(operation.Targetable).TargetAddress(), amount)
+	case operation.TypeCollectTxFee, operation.TypeInflation:
+		amount := op.B.(operation.Payable).GetAmount()
+		r.inflation[op.H.Type] = r.inflation[op.H.Type].MustAdd(amount)
+		return r.add(op.B.(operation.Targetable).TargetAddress(), amount)
+	case operation.TypeInflationPF:
+		amount := op.B.(operation.InflationPF).GetAmount()
+		r.inflation[op.H.Type] = r.inflation[op.H.Type].MustAdd(amount)
+		return r.add(op.B.(operation.Targetable).TargetAddress(), amount)
+	case operation.TypeUnfreezingRequest:
+		r.unfreezing[source] = height
+	}
+
+	return nil
+}
+
+// block applies the transactions of block.
+func (r *Replay) block(blk block.Block) error {
+	hashes := blk.Transactions
+	if blk.Height != common.GenesisBlockHeight {
+		hashes = append([]string{blk.ProposerTransaction}, hashes...)
+	}
+
+	for _, hash := range hashes {
+		tx, err := getTransaction(hash)
+		if err != nil {
+			return fmt.Errorf("failed to get transaction: %s: %v", hash, err)
+		}
+
+		if err := r.sub(tx.B.Source, tx.B.Fee); err != nil {
+			return fmt.Errorf("transaction, %s: %v", hash, err)
+		}
+
+		for _, op := range tx.B.Operations {
+			if err := r.operation(blk.Height, tx.B.Source, op); err != nil {
+				return fmt.Errorf("operation of transaction, %s: %v", hash, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// row returns the history row at the block height.
+func (r *Replay) row(height uint64) HistoryRow {
+	row := HistoryRow{
+		Height:         height,
+		BlockInflation: r.inflation[operation.TypeInflation],
+		PFInflation:    r.inflation[operation.TypeInflationPF],
+	}
+
+	for address, balance := range r.balances {
+		if balance < 1 {
+			continue
+		}
+		row.Total = row.Total.MustAdd(balance)
+		row.Holders += 1
+
+		if _, found := r.linked[address]; !found {
+			continue
+		}
+		if h, found := r.unfreezing[address]; found && height-h >= common.UnfreezingPeriod {
+			continue
+		}
+		row.Frozen = row.Frozen.MustAdd(balance)
+	}
+
+	row.Circulating = row.Total
+	for _, address := range excludeAddresses {
+		row.Circulating = row.Circulating.MustSub(r.balances[address])
+	}
+
+	return row
+}
+
+// backfill rebuilds the history at every `-backfill` blocks from genesis by
+// replaying the operations.
+func backfill() error {
+	r := NewReplay()
+	rows := []string{historyHeader}
+
+	var cursor []byte
+	var height uint64
+	for {
+		result, err := getBlocks(cursor)
+		if err != nil {
+			return fmt.Errorf("failed to get blocks: %v", err)
+		}
+
+		for _, item := range result.Items {
+			// the block of cursor is already replayed
+			if cursor != nil && bytes.Equal(item.Key, cursor) {
+				continue
+			}
+
+			var hash string
+			if err := json.Unmarshal(item.Value, &hash); err != nil {
+				return fmt.Errorf("invalid value: %v", err)
+			}
+
+			blk, err := getBlock(hash)
+			if err != nil {
+				return fmt.Errorf("failed to get block: %s: %v", hash, err)
+			}
+
+			if err := r.block(blk); err != nil {
+				return fmt.Errorf("failed to replay block: %d: %v", blk.Height, err)
+			}
+			height = blk.Height
+
+			if height%flagBackfill == 0 {
+				rows = append(rows, r.row(height).String())
+				log.Debug("history backfilled", "height", height)
+			}
+		}
+
+		if uint64(len(result.Items)) < result.Limit {
+			break
+		}
+		cursor = result.Items[len(result.Items)-1].Key
+	}
+
+	publish(historyFile, []byte(strings.Join(rows, "\n")+"\n"))
+	log.Info("history backfilled", "rows", len(rows)-1, "height", height)
+
+	return nil
+}
@@ -9,16 +9,11 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	jsonrpc "github.com/gorilla/rpc/json"
 	logging "github.com/inconshreveable/log15"
 	isatty "github.com/mattn/go-isatty"
@@ -57,6 +52,20 @@ var (
 	flagAWSSecretKey    string
 	flagTopHoldersLimit int = 3000
 	flagExcludeAccount  cmdcommon.ListFlags
+	flagPublisher       string = "s3" // "local", "webhook", "git"
+	flagDirectory       string
+	flagWebhookURL      string
+	flagWebhookMethod   string = "PUT"
+	flagWebhookHeader   cmdcommon.ListFlags
+	flagGitRepository   string
+	flagGitPath         string
+	flagGitMessage      string = "update sebak stats"
+	flagGitPush         bool
+	flagServe           string
+	flagRefresh         string = "60s" // "block"
+	flagBackfill        uint64
+	flagMetricsFile     string
+	flagStateFile       string
 )
 
 var (
@@ -67,7 +76,7 @@ var (
 	logLevel        logging.Lvl
 	log             logging.Logger = logging.New("module", "sebak-stats")
 	client          *network.HTTP2NetworkClient
-	awsSession      *session.Session
+	publisher       Publisher
 	nodeInfo        node.NodeInfo
 
 	snapshot string
@@ -80,9 +89,10 @@ var (
 	circulatingSupplyFile        string
 	circulatingSupplyDetailsFile string
 	frozenAccountFile            string
+	historyFile                  string
 	dryrunDirectory              string
-	excludeAccounts              []block.BlockAccount
-	excludeAmount                common.Amount
+	excludeAddresses             []string
+	refreshInterval              time.Duration
 )
 
 var chanStop = make(chan os.Signal, 1)
@@ -191,6 +201,20 @@ func init() {
 	flags.StringVar(&flagS3Path, "s3-path", flagS3Path, "s3 file path")
 	flags.StringVar(&flagS3ACL, "s3-acl", flagS3ACL, "s3 acl; {public-read}")
 	flags.Var(&flagExcludeAccount, "exclude-account", "exclude account for circulating-supply.txt")
+	flags.StringVar(&flagPublisher, "publisher", flagPublisher, "where the files are published; {s3, local, webhook, git}")
+	flags.StringVar(&flagDirectory, "directory", flagDirectory, "local directory for 'local' publisher")
+	flags.StringVar(&flagWebhookURL, "webhook-url", flagWebhookURL, "base url for 'webhook' publisher; file name is appended")
+	flags.StringVar(&flagWebhookMethod, "webhook-method", flagWebhookMethod, "http method for 'webhook' publisher; {PUT, POST}")
+	flags.Var(&flagWebhookHeader, "webhook-header", "http header for 'webhook' publisher; '<key>: <value>'")
+	flags.StringVar(&flagGitRepository, "git-repository", flagGitRepository, "local git repository for 'git' publisher")
+	flags.StringVar(&flagGitPath, "git-path", flagGitPath, "directory in git repository for 'git' publisher")
+	flags.StringVar(&flagGitMessage, "git-message", flagGitMessage, "commit message for 'git' publisher")
+	flags.BoolVar(&flagGitPush, "git-push", flagGitPush, "push after commit for 'git' publisher")
+	flags.StringVar(&flagServe, "serve", flagServe, "serve stats over http api at this address, like '0.0.0.0:8080'")
+	flags.StringVar(&flagRefresh, "refresh", flagRefresh, "with -serve, interval to refresh stats, like '60s'; 'block' refreshes at each new block")
+	flags.Uint64Var(&flagBackfill, "backfill", flagBackfill, "rebuild history from genesis at every this number of blocks")
+	flags.StringVar(&flagMetricsFile, "metrics-file", flagMetricsFile, "without -serve, write prometheus metrics to this file for textfile collector")
+	flags.StringVar(&flagStateFile, "state-file", flagStateFile, "local file to keep the account state between runs; without it, all the accounts are scanned")
 
 	flags.Parse(os.Args[1:])
 
@@ -229,17 +253,30 @@ func init() {
 		log.SetHandler(logHandler)
 	}
 
-	if len(flagS3Bucket) < 1 {
-		printFlagsError("--s3-bucket", fmt.Errorf("must be given"))
-	}
-
-	{
-		os.Setenv("AWS_ACCESS_KEY_ID", flagAWSAccessKeyID)
-		os.Setenv("AWS_SECRET_ACCESS_KEY", flagAWSSecretKey)
+	if len(flagServe) > 0 {
+		if flagDryrun {
+			printFlagsError("--dry-run", fmt.Errorf("can not be used with --serve"))
+		}
+		if flagBackfill > 0 {
+			printFlagsError("--backfill", fmt.Errorf("can not be used with --serve"))
+		}
+		if len(flagMetricsFile) > 0 {
+			printFlagsError("--metrics-file", fmt.Errorf("can not be used with --serve; metrics are served at /metrics"))
+		}
 
+		if flagRefresh != "block" {
+			if d, err := time.ParseDuration(flagRefresh); err != nil {
+				printFlagsError("--refresh", err)
+			} else if d < time.Second {
+				printFlagsError("--refresh", fmt.Errorf("must be longer than 1s"))
+			} else {
+				refreshInterval = d
+			}
+		}
+	} else {
 		var err error
-		if awsSession, err = session.NewSession(&aws.Config{Region: aws.String(flagS3Region)}); err != nil {
-			printFlagsError("failed to access aws s3", err)
+		if publisher, err = newPublisher(flagPublisher); err != nil {
+			printFlagsError("--publisher", err)
 		}
 	}
 
@@ -280,7 +317,9 @@ func init() {
 			printError("failed to create temp directory", err)
 		}
 		dryrunDirectory = f
-		flagS3Path = ""
+		if publisher, err = NewDryrunPublisher(publisher, dryrunDirectory); err != nil {
+			printError("failed to create dryrun publisher", err)
+		}
 		log.Info("output files will be saved in", "directory", dryrunDirectory)
 	}
 
@@ -304,7 +343,6 @@ func init() {
 		}()
 	}
 
-	var excludeAddresses []string
 	{ // common account
 		blk, err := getBlockByHeight(common.GenesisBlockHeight)
 		if err != nil {
@@ -335,24 +373,8 @@ func init() {
 		}
 
 		// check accounts exist
-		for _, address := range excludeAddresses {
-			var found bool
-			for _, a := range excludeAccounts {
-				if a.Address == address {
-					found = true
-					break
-				}
-			}
-			if found {
-				continue
-			}
-
-			ac, err := getAccount(address)
-			if err != nil {
-				printError(fmt.Sprintf("exclude account, '%s' does not exist", address), err)
-			}
-			excludeAccounts = append(excludeAccounts, ac)
-			excludeAmount = excludeAmount.MustAdd(ac.Balance)
+		if _, _, err := getExcludeAccounts(); err != nil {
+			printError("failed to load exclude accounts", err)
 		}
 	}
 
@@ -364,24 +386,32 @@ func init() {
 	parsedFlags = append(parsedFlags, "\n\tlog", flagLog)
 	parsedFlags = append(parsedFlags, "\n\tnetwork-id", string(networkID))
 	parsedFlags = append(parsedFlags, "\n\ttop-holders-limit", flagTopHoldersLimit)
+	parsedFlags = append(parsedFlags, "\n\tserve", flagServe)
+	parsedFlags = append(parsedFlags, "\n\trefresh", flagRefresh)
+	parsedFlags = append(parsedFlags, "\n\tbackfill", flagBackfill)
+	parsedFlags = append(parsedFlags, "\n\tmetrics-file", flagMetricsFile)
+	parsedFlags = append(parsedFlags, "\n\tstate-file", flagStateFile)
+	parsedFlags = append(parsedFlags, "\n\tpublisher", flagPublisher)
+	parsedFlags = append(parsedFlags, "\n\tpublish-to", publisher)
 	parsedFlags = append(parsedFlags, "\n\ts3Bucket", flagS3Bucket)
 	parsedFlags = append(parsedFlags, "\n\ts3-path", flagS3Path)
 	parsedFlags = append(parsedFlags, "\n\ts3-path", flagS3ACL)
 	parsedFlags = append(parsedFlags, "\n\ts3-region", flagS3Region)
 	parsedFlags = append(parsedFlags, "\n\tdryrun-directory", dryrunDirectory)
 	parsedFlags = append(parsedFlags, "\n\texclude-account", excludeAddresses)
-	parsedFlags = append(parsedFlags, "\n\texclude-amount", excludeAmount)
 
 	log.Debug("parsed flags:", parsedFlags...)
 
-	latestBlockFile = filepath.Join(flagS3Path, "latest-block.txt")
-	totalInflationFile = filepath.Join(flagS3Path, "total-inflation.txt")
-	totalSupplyFile = filepath.Join(flagS3Path, "total-supply.txt")
-	totalSupplyDetailsFile = filepath.Join(flagS3Path, "total-supply-details.txt")
-	totalHoldersFile = filepath.Join(flagS3Path, "top-holders%s.txt")
-	frozenAccountFile = filepath.Join(flagS3Path, "frozen-accounts.txt")
-	circulatingSupplyFile = filepath.Join(flagS3Path, "circulating-supply.txt")
-	circulatingSupplyDetailsFile = filepath.Join(flagS3Path, "circulating-supply-details.txt")
+	// the path of s3 is joined by S3Publisher
+	latestBlockFile = "latest-block.txt"
+	totalInflationFile = "total-inflation.txt"
+	totalSupplyFile = "total-supply.txt"
+	totalSupplyDetailsFile = "total-supply-details.txt"
+	totalHoldersFile = "top-holders%s.txt"
+	frozenAccountFile = "frozen-accounts.txt"
+	circulatingSupplyFile = "circulating-supply.txt"
+	circulatingSupplyDetailsFile = "circulating-supply-details.txt"
+	historyFile = "history.txt"
 }
 
 func openSnapshot() (snapshot string, err error) {
@@ -533,6 +563,44 @@ func getBlocks(cursor []byte) (result runner.DBGetIteratorResult, err error) {
 	return
 }
 
+// getBlockOperationsByHeight iterates the block operations by block height.
+func getBlockOperationsByHeight(cursor []byte) (result runner.DBGetIteratorResult, err error) {
+	args := runner.DBGetIteratorArgs{
+		Snapshot: snapshot,
+		Prefix:   common.BlockOperationPrefixBlockHeight,
+		Options: runner.GetIteratorOptions{
+			Limit:   runner.MaxLimitListOptions,
+			Cursor:  cursor,
+			Reverse: false,
+		},
+	}
+
+	var message []byte
+	if message, err = jsonrpc.EncodeClientRequest("DB.GetIterator", &args); err != nil {
+		return
+	}
+
+	var req *http.Request
+	if req, err = http.NewRequest("POST", jsonrpcEndpoint.String(), bytes.NewBuffer(message)); err != nil {
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	client := new(http.Client)
+
+	var resp *http.Response
+	if resp, err = client.Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if err = jsonrpc.DecodeClientResponse(resp.Body, &result); err != nil {
+		return
+	}
+
+	return
+}
+
 func getDB(key string) (result runner.DBGetResult, err error) {
 	args := runner.DBGetArgs{
 		Snapshot: snapshot,
@@ -605,99 +673,76 @@ func getTransaction(hash string) (tx transaction.Transaction, err error) {
 	return
 }
 
-func downloadS3(key string) ([]byte, error) {
-	downloader := s3manager.NewDownloader(awsSession)
-
-	w := aws.NewWriteAtBuffer([]byte{})
-
-	_, err := downloader.Download(
-		w,
-		&s3.GetObjectInput{
-			Bucket: aws.String(flagS3Bucket),
-			Key:    aws.String(key),
-		},
-	)
-	if err != nil {
-		return nil, err
+func publish(path string, body []byte) {
+	if err := publisher.Publish(path, body); err != nil {
+		log.Error("failed to publish", "file", path, "publisher", flagPublisher, "error", err)
+		printError(fmt.Sprintf("failed to publish %s", path), err)
 	}
-
-	return w.Bytes(), nil
 }
 
-func uploadS3(path string, body []byte) {
-	if flagDryrun {
-		err := ioutil.WriteFile(filepath.Join(dryrunDirectory, path), body, 0644)
-		if err != nil {
-			printError("failed to save file in dryrun directory", err)
-		}
-
-		return
-	}
-
-	uploadInput := &s3manager.UploadInput{
-		Bucket: aws.String(flagS3Bucket),
-		Key:    aws.String(path),
-		Body:   bytes.NewReader(body),
-	}
-	if len(flagS3ACL) > 0 {
-		uploadInput.ACL = aws.String(flagS3ACL)
-	}
+type SortByBalance []block.BlockAccount
 
-	svc := s3manager.NewUploader(awsSession)
-	output, err := svc.Upload(uploadInput)
-	if err != nil {
-		log.Error("failed to upload to s3", "file", path, "erorr", err)
-		printError(fmt.Sprintf("failed to upload %s to s3", path), err)
+func (a SortByBalance) Len() int      { return len(a) }
+func (a SortByBalance) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a SortByBalance) Less(i, j int) bool {
+	if a[i].Balance == a[j].Balance {
+		return a[i].Address < a[j].Address
 	}
-	log.Debug("uploaded", "location", output.Location, "path", path)
+	return a[i].Balance > a[j].Balance
 }
 
-type SortByBalance []block.BlockAccount
-
-func (a SortByBalance) Len() int           { return len(a) }
-func (a SortByBalance) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a SortByBalance) Less(i, j int) bool { return a[i].Balance > a[j].Balance }
-
-func getInflation() (height uint64, inflation map[operation.OperationType]common.Amount, err error) {
+// loadInflation reads the latest block and inflation from publisher; the
+// inflation is counted after the latest block.
+func loadInflation() (height uint64, inflation map[operation.OperationType]common.Amount) {
 	inflation = map[operation.OperationType]common.Amount{}
 
-	if !flagInit {
-		{
-			// latest block from s3
-			var b []byte
-			if b, err = downloadS3(latestBlockFile); err != nil {
-				log.Error("failed to download `.latest-block.txt` from s3", "error", err)
-			} else {
-				log.Debug("downloaded `.latest-block.txt` from s3", "content", string(b))
-				if height, err = strconv.ParseUint(string(b), 10, 64); err != nil {
-					log.Error("failed parse `.latest-block.txt`", "error", err)
-					height = 0
-				}
+	{
+		// latest block from publisher
+		b, err := publisher.Get(latestBlockFile)
+		if err != nil {
+			log.Error("failed to download `.latest-block.txt` from publisher", "error", err)
+		} else {
+			log.Debug("downloaded `.latest-block.txt` from publisher", "content", string(b))
+			if height, err = strconv.ParseUint(string(b), 10, 64); err != nil {
+				log.Error("failed parse `.latest-block.txt`", "error", err)
+				height = 0
 			}
-
-			log.Debug("start height", "height", height)
 		}
 
-		if height > 0 { // latest inflation data
-			var b []byte
-			if b, err = downloadS3(totalInflationFile); err != nil {
-				log.Error("failed to download latest inflation data from s3", "error", err)
+		log.Debug("start height", "height", height)
+	}
+
+	if height > 0 { // latest inflation data
+		b, err := publisher.Get(totalInflationFile)
+		if err != nil {
+			log.Error("failed to download latest inflation data from publisher", "error", err)
+		} else {
+			log.Debug("downloaded latest inflation data from publisher", "content", string(b))
+
+			l := parseCSV(string(b))
+			if len(l) < 1 {
+				log.Error("failed to parse downloaded latest inflation data from publisher")
+			} else if len(l[0]) < 3 {
+				log.Error("invalid downloaded latest inflation data from publisher", "data", l)
 			} else {
-				log.Debug("downloaded latest inflation data from s3", "content", string(b))
-
-				l := parseCSV(string(b))
-				if len(l) < 1 {
-					log.Error("failed to parse downloaded latest inflation data from s3")
-				} else if len(l[0]) < 3 {
-					log.Error("invalid downloaded latest inflation data from s3", "data", l)
-				} else {
-					inflation[operation.TypeInflation] = bosToString(l[0][1])
-					inflation[operation.TypeInflationPF] = bosToString(l[0][2])
-				}
+				inflation[operation.TypeInflation] = bosToString(l[0][1])
+				inflation[operation.TypeInflationPF] = bosToString(l[0][2])
 			}
-
-			log.Debug("latest inflation data loaded", "data", inflation)
 		}
+
+		log.Debug("latest inflation data loaded", "data", inflation)
+	}
+
+	return
+}
+
+// getInflation counts the inflation from the blocks after height; the counted
+// inflation is added to the given inflation.
+func getInflation(startHeight uint64, startInflation map[operation.OperationType]common.Amount) (height uint64, inflation map[operation.OperationType]common.Amount, err error) {
+	height = startHeight
+	inflation = map[operation.OperationType]common.Amount{}
+	for t, amount := range startInflation {
+		inflation[t] = amount
 	}
 
 	var cursor []byte
@@ -716,6 +761,11 @@ func getInflation() (height uint64, inflation map[operation.OperationType]common
 		}
 
 		for _, item := range result.Items {
+			// the block of cursor is already counted
+			if cursor != nil && bytes.Equal(item.Key, cursor) {
+				continue
+			}
+
 			var hash string
 			if err = json.Unmarshal(item.Value, &hash); err != nil {
 				log.Error("invalid value", "error", err)
@@ -871,187 +921,65 @@ var circulatingDetailsTemplate = `# address, amount, description
 "-",%s,"circulating supply"`
 
 func main() {
-	var lastBlockHeight uint64
-
-	{ // inflation
-		lastHeight, inflation, err := getInflation()
-		lastBlockHeight = lastHeight
-		if err != nil {
-			printError("failed to get inflation", err)
-		}
-		log.Debug("inflation amount", "inflation", inflation, "block", lastHeight)
-
-		t := fmt.Sprintf(
-			inflationTemplate,
-			gonToBOS(nodeInfo.Policy.InitialBalance),
-			gonToBOS(inflation[operation.TypeInflation]),
-			gonToBOS(inflation[operation.TypeInflationPF]),
-		)
-
-		uploadS3(
-			totalInflationFile,
-			[]byte(t),
-		)
-		uploadS3(
-			latestBlockFile,
-			[]byte(strconv.FormatUint(lastHeight, 10)),
-		)
+	if len(flagServe) > 0 {
+		serve()
+		exit(0)
 	}
 
-	membershipCount := map[string]bool{}
-	var frozen []string
-	var unfrozen []string
-	var frozenAmount common.Amount
-
-	accountsMap := map[string]block.BlockAccount{}
-	var accountsByBalance []block.BlockAccount
-	{
-		log.Debug("getting all the accounts")
-
-		var cursor []byte
-		for {
-			result, err := getAccounts(cursor)
-			if err != nil {
-				printError("failed to get accounts", err)
-			}
-			for _, item := range result.Items {
-				var account block.BlockAccount
-				if err := json.Unmarshal(item.Value, &account); err != nil {
-					printError("invalid value", err)
-				}
-				if _, found := accountsMap[string(account.Address)]; found {
-					printError("duplicated key found", nil)
-				}
-
-				accountsMap[account.Address] = account
-				if account.Balance > common.Amount(0) {
-					accountsByBalance = append(accountsByBalance, account)
-				}
-				if len(account.Linked) > 0 {
-					frozen = append(frozen, account.Address)
-					frozenAmount = frozenAmount.MustAdd(account.Balance)
-					membershipCount[account.Linked] = true
-				}
-			}
-
-			if uint64(len(result.Items)) < result.Limit {
-				break
-			}
-			cursor = result.Items[len(result.Items)-1].Key
+	if flagBackfill > 0 {
+		if err := backfill(); err != nil {
+			printError("failed to backfill history", err)
 		}
-
-		log.Debug("all accounts", "accounts", len(accountsMap), "over-1", len(accountsByBalance))
-
 	}
 
-	{ // frozen account
-		var unfrozenAmount common.Amount
-		for _, address := range frozen {
-			bo, err := getLastBlockOperation(address)
-			if err != nil {
-				log.Crit("failed to get BlockOperation", "address", address, "error", err)
-				printError("failed to get BlockOperation", err)
-			}
-
-			if bo.Type != operation.TypeUnfreezingRequest {
-				continue
-			}
-			if lastBlockHeight-bo.Height < common.UnfreezingPeriod {
-				continue
-			}
-			unfrozen = append(unfrozen, address)
-			account := accountsMap[address]
-			unfrozenAmount = unfrozenAmount.MustAdd(account.Balance)
-		}
-
-		log.Debug(
-			"all freezing accounts",
-			"all", len(frozen),
-			"frozen", len(frozen)-len(unfrozen),
-			"unfrozen", len(unfrozen),
-			"frozen-amount", frozenAmount-unfrozenAmount,
-			"unfrozen-amount", unfrozenAmount,
-			"membership-count", len(membershipCount),
-		)
-
-		t := fmt.Sprintf(
-			frozenTemplate,
-			len(membershipCount),
-			len(frozen)-len(unfrozen),
-			gonToBOS(frozenAmount-unfrozenAmount),
-			len(unfrozen),
-			gonToBOS(unfrozenAmount),
-		)
-
-		uploadS3(frozenAccountFile, []byte(t))
+	var height uint64
+	var inflation map[operation.OperationType]common.Amount
+	state := NewAccountState()
+	if !flagInit {
+		height, inflation = loadInflation()
+		state = loadAccountState()
 	}
 
-	{
-		log.Debug("calculating total supply")
-		var total uint64
-		for _, account := range accountsByBalance {
-			total += uint64(account.Balance)
-		}
-
-		log.Debug("total balance", "supply", total)
-
-		uploadS3(totalSupplyFile, []byte(gonToBOS(total)))
-
-		t := fmt.Sprintf(
-			totalSupplyDetailsTemplate,
-			lastBlockHeight,
-			gonToBOS(total),
-		)
-		uploadS3(totalSupplyDetailsFile, []byte(t))
-
-		// circulating-supply.txt
-		circulating := total - uint64(excludeAmount)
-		log.Debug("circulating supply", "supply", circulating, "exclude", excludeAmount)
+	stats, err := collectStats(height, inflation, state)
+	if err != nil {
+		printError("failed to collect stats", err)
+	}
 
-		uploadS3(circulatingSupplyFile, []byte(gonToBOS(circulating)))
+	// the state is saved first and the latest block is published last, so the
+	// reports and history are not ahead of the saved state.
+	if flagDryrun {
+		log.Debug("account state is not saved by -dry-run")
+	} else if err := state.Save(); err != nil {
+		printError("failed to save account state", err)
+	}
+
+	publish(frozenAccountFile, []byte(stats.FrozenText()))
+	publish(totalSupplyFile, []byte(stats.TotalSupplyText()))
+	publish(totalSupplyDetailsFile, []byte(stats.TotalSupplyDetailsText()))
+	publish(circulatingSupplyFile, []byte(stats.CirculatingSupplyText()))
+	publish(circulatingSupplyDetailsFile, []byte(stats.CirculatingSupplyDetailsText()))
+	publish(
+		fmt.Sprintf(
+			totalHoldersFile,
+			fmt.Sprintf("-%d", flagTopHoldersLimit),
+		),
+		[]byte(stats.TopHoldersText(flagTopHoldersLimit)),
+	)
+	publish(fmt.Sprintf(totalHoldersFile, ""), []byte(stats.TopHoldersText(0)))
+	appendHistory(NewHistoryRowFromStats(stats))
+	publish(totalInflationFile, []byte(stats.InflationText()))
+	publish(latestBlockFile, []byte(strconv.FormatUint(stats.Height, 10)))
 
-		circulatingDetails := fmt.Sprintf(circulatingDetailsTemplate, gonToBOS(circulating))
-		for _, ac := range excludeAccounts {
-			circulatingDetails += fmt.Sprintf("\n%s,%s,\"\"", ac.Address, gonToBOS(ac.Balance))
-		}
-		uploadS3(circulatingSupplyDetailsFile, []byte(circulatingDetails))
+	if err := publisher.Close(); err != nil {
+		printError("failed to close publisher", err)
 	}
 
-	{
-		log.Debug("sorting top holders")
-		sort.Sort(SortByBalance(accountsByBalance))
-
-		csv := []string{"# order,address,balance"}
-		csvAll := []string{"# order,address,balance"}
-
-		for i, account := range accountsByBalance {
-			if i < flagTopHoldersLimit {
-				csv = append(csv, fmt.Sprintf(
-					"%d,%s,%s",
-					i,
-					account.Address,
-					gonToBOS(account.Balance),
-				))
-			}
-			csvAll = append(csvAll, fmt.Sprintf(
-				"%d,%s,%s",
-				i,
-				account.Address,
-				gonToBOS(account.Balance),
-			))
+	if len(flagMetricsFile) > 0 {
+		metrics := NewStatsMetrics()
+		metrics.Update(stats)
+		if err := metrics.WriteToTextfile(flagMetricsFile); err != nil {
+			printError("failed to write metrics", err)
 		}
-
-		uploadS3(
-			fmt.Sprintf(
-				totalHoldersFile,
-				fmt.Sprintf("-%d", flagTopHoldersLimit),
-			),
-			[]byte(strings.Join(csv, "\n")),
-		)
-		uploadS3(
-			fmt.Sprintf(totalHoldersFile, ""),
-			[]byte(strings.Join(csvAll, "\n")),
-		)
 	}
 
 	exit(0)
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+
+	"boscoin.io/sebak/lib/transaction/operation"
+)
+
+const metricsNamespace string = "sebak_stats"
+
+// gonPerBOS is 10^7; see gonToBOS.
+const gonPerBOS float64 = 10000000
+
+// StatsMetrics exports the stats as prometheus gauges; the amounts are in BOS.
+type StatsMetrics struct {
+	registry *prometheus.Registry
+
+	totalSupply         prometheus.Gauge
+	circulatingSupply   prometheus.Gauge
+	excludeAmount       prometheus.Gauge
+	frozenAccounts      prometheus.Gauge
+	frozenAmount        prometheus.Gauge
+	unfrozenAccounts    prometheus.Gauge
+	unfrozenAmount      prometheus.Gauge
+	membership          prometheus.Gauge
+	blockInflation      prometheus.Gauge
+	pfInflation         prometheus.Gauge
+	latestBlockHeight   prometheus.Gauge
+	accountsWithBalance prometheus.Gauge
+	updated             prometheus.Gauge
+}
+
+func newGauge(name, help string) prometheus.Gauge {
+	return prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      name,
+		Help:      help,
+	})
+}
+
+func NewStatsMetrics() *StatsMetrics {
+	m := &StatsMetrics{
+		registry:            prometheus.NewRegistry(),
+		totalSupply:         newGauge("total_supply_bos", "total supply in BOS"),
+		circulatingSupply:   newGauge("circulating_supply_bos", "circulating supply in BOS"),
+		excludeAmount:       newGauge("exclude_amount_bos", "balance of the excluded accounts from circulating supply in BOS"),
+		frozenAccounts:      newGauge("frozen_accounts", "number of frozen accounts"),
+		frozenAmount:        newGauge("frozen_amount_bos", "frozen amount in BOS"),
+		unfrozenAccounts:    newGauge("unfrozen_accounts", "number of unfrozen accounts"),
+		unfrozenAmount:      newGauge("unfrozen_amount_bos", "unfrozen amount in BOS"),
+		membership:          newGauge("membership", "number of membership"),
+		blockInflation:      newGauge("block_inflation_bos", "total block inflation in BOS"),
+		pfInflation:         newGauge("pf_inflation_bos", "total PF inflation in BOS"),
+		latestBlockHeight:   newGauge("latest_block_height", "latest block height of stats"),
+		accountsWithBalance: newGauge("accounts_with_balance", "number of accounts, which have non-zero balance"),
+		updated:             newGauge("updated_timestamp_seconds", "unix time of the last refresh"),
+	}
+
+	m.registry.MustRegister(
+		m.totalSupply,
+		m.circulatingSupply,
+		m.excludeAmount,
+		m.frozenAccounts,
+		m.frozenAmount,
+		m.unfrozenAccounts,
+		m.unfrozenAmount,
+		m.membership,
+		m.blockInflation,
+		m.pfInflation,
+		m.latestBlockHeight,
+		m.accountsWithBalance,
+		m.updated,
+	)
+
+	return m
+}
+
+// gonToBOSFloat converts GON to BOS for gauge.
+func gonToBOSFloat(a uint64) float64 {
+	return float64(a) / gonPerBOS
+}
+
+// Update sets the gauges by the stats.
+func (m *StatsMetrics) Update(stats *Stats) {
+	m.totalSupply.Set(gonToBOSFloat(stats.Total))
+	m.circulatingSupply.Set(gonToBOSFloat(stats.Circulating))
+	m.excludeAmount.Set(gonToBOSFloat(uint64(stats.ExcludeAmount)))
+	m.frozenAccounts.Set(float64(stats.FrozenCount))
+	m.frozenAmount.Set(gonToBOSFloat(uint64(stats.FrozenAmount)))
+	m.unfrozenAccounts.Set(float64(stats.UnfrozenCount))
+	m.unfrozenAmount.Set(gonToBOSFloat(uint64(stats.UnfrozenAmount)))
+	m.membership.Set(float64(stats.MembershipCount))
+	m.blockInflation.Set(gonToBOSFloat(uint64(stats.Inflation[operation.TypeInflation])))
+	m.pfInflation.Set(gonToBOSFloat(uint64(stats.Inflation[operation.TypeInflationPF])))
+	m.latestBlockHeight.Set(float64(stats.Height))
+	m.accountsWithBalance.Set(float64(len(stats.AccountsByBalance)))
+	m.updated.Set(float64(time.Now().Unix()))
+}
+
+// WriteToTextfile writes the gauges in the text format for the textfile
+// collector of node_exporter; it is for running by cron without -serve. The
+// file is written to the temp file and renamed, so the collector does not read
+// the partial file.
+func (m *StatsMetrics) WriteToTextfile(filename string) error {
+	families, err := m.registry.Gather()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(tmp, family); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// the temp file is created with 0600
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+func (m *StatsMetrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// errNotPublished is returned by Publisher.Get when the file does not exist.
+var errNotPublished error = fmt.Errorf("file not published")
+
+// Publisher stores the stats files; the previous files are also read from it
+// to continue from the latest block.
+type Publisher interface {
+	Publish(path string, body []byte) error
+	// Get returns errNotPublished, if the file does not exist.
+	Get(path string) ([]byte, error)
+	// Close finishes publishing; the git publisher commits the files.
+	Close() error
+	String() string
+}
+
+func newPublisher(name string) (Publisher, error) {
+	switch name {
+	case "s3":
+		return NewS3Publisher(flagS3Bucket, flagS3Path, flagS3Region, flagS3ACL)
+	case "local":
+		return NewLocalPublisher(flagDirectory)
+	case "webhook":
+		return NewWebhookPublisher(flagWebhookURL, flagWebhookMethod, flagWebhookHeader)
+	case "git":
+		return NewGitPublisher(flagGitRepository, flagGitPath, flagGitMessage, flagGitPush)
+	default:
+		return nil, fmt.Errorf("unknown publisher found: %s", name)
+	}
+}
+
+// S3Publisher uploads the files to the s3 bucket.
+type S3Publisher struct {
+	session *session.Session
+	bucket  string
+	path    string
+	acl     string
+}
+
+func NewS3Publisher(bucket, path, region, acl string) (*S3Publisher, error) {
+	if len(bucket) < 1 {
+		return nil, fmt.Errorf("--s3-bucket must be given")
+	}
+
+	os.Setenv("AWS_ACCESS_KEY_ID", flagAWSAccessKeyID)
+	os.Setenv("AWS_SECRET_ACCESS_KEY", flagAWSSecretKey)
+
+	s, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to access aws s3: %v", err)
+	}
+
+	return &S3Publisher{session: s, bucket: bucket, path: path, acl: acl}, nil
+}
+
+// key returns the s3 object key of the file; the key is always separated by
+// slash.
+func (p *S3Publisher) key(name string) string {
+	return path.Join(p.path, name)
+}
+
+func (p *S3Publisher) Publish(name string, body []byte) error {
+	uploadInput := &s3manager.UploadInput{
+		Bucket: aws.String(p.bucket),
+		Key:    aws.String(p.key(name)),
+		Body:   bytes.NewReader(body),
+	}
+	if len(p.acl) > 0 {
+		uploadInput.ACL = aws.String(p.acl)
+	}
+
+	svc := s3manager.NewUploader(p.session)
+	output, err := svc.Upload(uploadInput)
+	if err != nil {
+		return err
+	}
+	log.Debug("uploaded", "location", output.Location, "path", name)
+
+	return nil
+}
+
+func (p *S3Publisher) Get(name string) ([]byte, error) {
+	downloader := s3manager.NewDownloader(p.session)
+
+	w := aws.NewWriteAtBuffer([]byte{})
+
+	_, err := downloader.Download(
+		w,
+		&s3.GetObjectInput{
+			Bucket: aws.String(p.bucket),
+			Key:    aws.String(p.key(name)),
+		},
+	)
+	if e, ok := err.(awserr.Error); ok && e.Code() == s3.ErrCodeNoSuchKey {
+		return nil, errNotPublished
+	} else if err != nil {
+		return nil, err
+	}
+
+	return w.Bytes(), nil
+}
+
+func (p *S3Publisher) Close() error {
+	return nil
+}
+
+func (p *S3Publisher) String() string {
+	return fmt.Sprintf("s3://%s", path.Join(p.bucket, p.path))
+}
+
+// LocalPublisher saves the files in the local directory.
+type LocalPublisher struct {
+	directory string
+}
+
+func NewLocalPublisher(directory string) (*LocalPublisher, error) {
+	if len(directory) < 1 {
+		return nil, fmt.Errorf("--directory must be given")
+	}
+
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+
+	return &LocalPublisher{directory: directory}, nil
+}
+
+func (p *LocalPublisher) Publish(path string, body []byte) error {
+	return ioutil.WriteFile(filepath.Join(p.directory, path), body, 0644)
+}
+
+func (p *LocalPublisher) Get(path string) ([]byte, error) {
+	return readPublishedFile(filepath.Join(p.directory, path))
+}
+
+func readPublishedFile(p string) ([]byte, error) {
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, errNotPublished
+	}
+
+	return b, err
+}
+
+func (p *LocalPublisher) Close() error {
+	return nil
+}
+
+func (p *LocalPublisher) String() string {
+	return p.directory
+}
+
+// WebhookPublisher sends the files to the url with `PUT` or `POST`; the file
+// name is appended to the url. The previous files are read by `GET` from the
+// same url.
+type WebhookPublisher struct {
+	url     string
+	method  string
+	headers http.Header
+	client  *http.Client
+}
+
+func NewWebhookPublisher(url, method string, headers []string) (*WebhookPublisher, error) {
+	if len(url) < 1 {
+		return nil, fmt.Errorf("--webhook-url must be given")
+	}
+
+	switch method {
+	case http.MethodPut, http.MethodPost:
+	default:
+		return nil, fmt.Errorf("--webhook-method must be PUT or POST")
+	}
+
+	h := http.Header{}
+	for _, s := range headers {
+		l := strings.SplitN(s, ":", 2)
+		if len(l) != 2 {
+			return nil, fmt.Errorf("invalid --webhook-header: %q", s)
+		}
+		h.Add(strings.TrimSpace(l[0]), strings.TrimSpace(l[1]))
+	}
+
+	return &WebhookPublisher{
+		url:     strings.TrimRight(url, "/"),
+		method:  method,
+		headers: h,
+		client:  new(http.Client),
+	}, nil
+}
+
+func (p *WebhookPublisher) request(method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, p.url+"/"+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range p.headers {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, errNotPublished
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to get response: status=%v", resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+func (p *WebhookPublisher) Publish(path string, body []byte) error {
+	resp, err := p.request(p.method, path, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	log.Debug("sent", "url", p.url+"/"+path, "method", p.method)
+
+	return nil
+}
+
+func (p *WebhookPublisher) Get(path string) ([]byte, error) {
+	resp, err := p.request(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (p *WebhookPublisher) Close() error {
+	return nil
+}
+
+func (p *WebhookPublisher) String() string {
+	return p.url
+}
+
+// GitPublisher saves the files in the local git repository and commits them at
+// Close; with push, the commit is pushed to the upstream.
+type GitPublisher struct {
+	repository string
+	path       string
+	message    string
+	push       bool
+}
+
+func NewGitPublisher(repository, path, message string, push bool) (*GitPublisher, error) {
+	if len(repository) < 1 {
+		return nil, fmt.Errorf("--git-repository must be given")
+	}
+
+	p := &GitPublisher{repository: repository, path: path, message: message, push: push}
+	if _, err := p.git("rev-parse", "--git-dir"); err != nil {
+		return nil, fmt.Errorf("not git repository: %s: %v", repository, err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(repository, path), 0755); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *GitPublisher) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", p.repository}, args...)...)
+	b, err := cmd.CombinedOutput()
+	if err != nil {
+		return b, fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(b)))
+	}
+
+	return b, nil
+}
+
+func (p *GitPublisher) Publish(path string, body []byte) error {
+	return ioutil.WriteFile(filepath.Join(p.repository, p.path, path), body, 0644)
+}
+
+func (p *GitPublisher) Get(path string) ([]byte, error) {
+	return readPublishedFile(filepath.Join(p.repository, p.path, path))
+}
+
+func (p *GitPublisher) Close() error {
+	if _, err := p.git("add", "--all", "--", filepath.Join(".", p.path)); err != nil {
+		return err
+	}
+
+	if b, err := p.git("status", "--porcelain", "--", filepath.Join(".", p.path)); err != nil {
+		return err
+	} else if len(bytes.TrimSpace(b)) < 1 {
+		log.Debug("nothing changed; not committed", "repository", p.repository)
+		return nil
+	}
+
+	if _, err := p.git("commit", "--message", p.message, "--", filepath.Join(".", p.path)); err != nil {
+		return err
+	}
+	log.Debug("committed", "repository", p.repository, "message", p.message)
+
+	if !p.push {
+		return nil
+	}
+
+	if _, err := p.git("push"); err != nil {
+		return err
+	}
+	log.Debug("pushed", "repository", p.repository)
+
+	return nil
+}
+
+func (p *GitPublisher) String() string {
+	return filepath.Join(p.repository, p.path)
+}
+
+// DryrunPublisher saves the files in the temp directory instead of publishing
+// them; the previous files are still read from the publisher.
+type DryrunPublisher struct {
+	Publisher
+	local *LocalPublisher
+}
+
+func NewDryrunPublisher(publisher Publisher, directory string) (*DryrunPublisher, error) {
+	local, err := NewLocalPublisher(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DryrunPublisher{Publisher: publisher, local: local}, nil
+}
+
+func (p *DryrunPublisher) Publish(path string, body []byte) error {
+	return p.local.Publish(path, body)
+}
+
+func (p *DryrunPublisher) Close() error {
+	return nil
+}
+
+func (p *DryrunPublisher) String() string {
+	return p.local.String()
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/node"
+	"boscoin.io/sebak/lib/transaction/operation"
+)
+
+// blockCheckInterval is the interval to check new block with `-refresh
+// block`.
+const blockCheckInterval time.Duration = time.Second * 5
+
+// StatsServer keeps the latest stats in memory and serves them; the inflation
+// is counted and the accounts are updated from the last refreshed block.
+type StatsServer struct {
+	sync.RWMutex
+
+	stats     *Stats
+	height    uint64
+	inflation map[operation.OperationType]common.Amount
+	state     *AccountState
+	metrics   *StatsMetrics
+}
+
+func NewStatsServer() *StatsServer {
+	return &StatsServer{
+		inflation: map[operation.OperationType]common.Amount{},
+		state:     NewAccountState(),
+		metrics:   NewStatsMetrics(),
+	}
+}
+
+func (s *StatsServer) Stats() *Stats {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.stats
+}
+
+// refresh collects the stats from the new snapshot.
+func (s *StatsServer) refresh() error {
+	var err error
+	if snapshot, err = openSnapshot(); err != nil {
+		return fmt.Errorf("failed to open snapshot: %v", err)
+	}
+	defer releaseSnapshot()
+
+	started := time.Now()
+	stats, err := collectStats(s.height, s.inflation, s.state)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	s.stats = stats
+	s.height = stats.Height
+	s.inflation = stats.Inflation
+	s.Unlock()
+
+	s.metrics.Update(stats)
+
+	log.Info("stats refreshed", "height", stats.Height, "elapsed", time.Since(started))
+
+	return nil
+}
+
+// latestHeight returns the latest block height of node.
+func latestHeight() (uint64, error) {
+	resp, err := client.Get("/")
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := node.NewNodeInfoFromJSON(resp)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Block.Height, nil
+}
+
+// run refreshes the stats by `-refresh`.
+func (s *StatsServer) run() {
+	interval := refreshInterval
+	if flagRefresh == "block" {
+		interval = blockCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if flagRefresh == "block" {
+			height, err := latestHeight()
+			if err != nil {
+				log.Error("failed to get latest block", "error", err)
+				continue
+			}
+			if stats := s.Stats(); stats != nil && height <= stats.Height {
+				continue
+			}
+		}
+
+		if err := s.refresh(); err != nil {
+			log.Error("failed to refresh stats", "error", err)
+		}
+	}
+}
+
+// wantJSON checks the response should be json, by `?format=json` or `Accept`
+// header.
+func wantJSON(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); len(f) > 0 {
+		return f == "json"
+	}
+
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// handle writes the plain text or json of the stats.
+func (s *StatsServer) handle(f func(*Stats, *http.Request) (string, interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats := s.Stats()
+		if stats == nil {
+			http.Error(w, "stats not ready", http.StatusServiceUnavailable)
+			return
+		}
+
+		text, v, err := f(stats, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("X-SEBAK-Block-Height", strconv.FormatUint(stats.Height, 10))
+		if !wantJSON(r) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, text)
+			return
+		}
+
+		b, err := json.Marshal(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	}
+}
+
+type StatsAccountJSON struct {
+	Address string `json:"address"`
+	Balance string `json:"balance"`
+}
+
+type StatsHolderJSON struct {
+	Order int `json:"order"`
+	StatsAccountJSON
+}
+
+func (s *StatsServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/total-supply", s.handle(func(stats *Stats, r *http.Request) (string, interface{}, error) {
+		return stats.TotalSupplyText(), map[string]interface{}{
+			"height":       stats.Height,
+			"updated":      stats.Updated,
+			"total-supply": gonToBOS(stats.Total),
+		}, nil
+	}))
+
+	mux.HandleFunc("/circulating-supply", s.handle(func(stats *Stats, r *http.Request) (string, interface{}, error) {
+		excluded := []StatsAccountJSON{}
+		for _, ac := range stats.ExcludeAccounts {
+			excluded = append(excluded, StatsAccountJSON{Address: ac.Address, Balance: gonToBOS(ac.Balance)})
+		}
+
+		return stats.CirculatingSupplyText(), map[string]interface{}{
+			"height":             stats.Height,
+			"updated":            stats.Updated,
+			"circulating-supply": gonToBOS(stats.Circulating),
+			"exclude-accounts":   excluded,
+		}, nil
+	}))
+
+	mux.HandleFunc("/top-holders", s.handle(func(stats *Stats, r *http.Request) (string, interface{}, error) {
+		limit := flagTopHoldersLimit
+		if l := r.URL.Query().Get("limit"); len(l) > 0 {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil || limit < 1 {
+				return "", nil, fmt.Errorf("invalid limit: %q", l)
+			}
+		}
+
+		holders := []StatsHolderJSON{}
+		for i, ac := range stats.topHolders(limit) {
+			holders = append(holders, StatsHolderJSON{
+				Order:            i,
+				StatsAccountJSON: StatsAccountJSON{Address: ac.Address, Balance: gonToBOS(ac.Balance)},
+			})
+		}
+
+		return stats.TopHoldersText(limit), map[string]interface{}{
+			"height":      stats.Height,
+			"updated":     stats.Updated,
+			"top-holders": holders,
+		}, nil
+	}))
+
+	mux.HandleFunc("/frozen", s.handle(func(stats *Stats, r *http.Request) (string, interface{}, error) {
+		return stats.FrozenText(), map[string]interface{}{
+			"height":          stats.Height,
+			"updated":         stats.Updated,
+			"membership":      stats.MembershipCount,
+			"frozen":          stats.FrozenCount,
+			"frozen-amount":   gonToBOS(stats.FrozenAmount),
+			"unfrozen":        stats.UnfrozenCount,
+			"unfrozen-amount": gonToBOS(stats.UnfrozenAmount),
+		}, nil
+	}))
+
+	mux.HandleFunc("/inflation", s.handle(func(stats *Stats, r *http.Request) (string, interface{}, error) {
+		return stats.InflationText(), map[string]interface{}{
+			"height":          stats.Height,
+			"updated":         stats.Updated,
+			"initial-balance": gonToBOS(nodeInfo.Policy.InitialBalance),
+			"block-inflation": gonToBOS(stats.Inflation[operation.TypeInflation]),
+			"pf-inflation":    gonToBOS(stats.Inflation[operation.TypeInflationPF]),
+		}, nil
+	}))
+
+	mux.Handle("/metrics", s.metrics.Handler())
+
+	return mux
+}
+
+// serve collects the stats and serves them over http api; the stats are
+// refreshed by `-refresh`.
+func serve() {
+	// the snapshot of init is not used; the new snapshot is opened at each
+	// refresh.
+	if err := releaseSnapshot(); err != nil {
+		log.Error("failed to release snapshot", "error", err)
+	}
+
+	server := NewStatsServer()
+	if err := server.refresh(); err != nil {
+		log.Error("failed to refresh stats", "error", err)
+	}
+
+	go server.run()
+
+	log.Info("serving stats", "address", flagServe, "refresh", flagRefresh)
+	if err := http.ListenAndServe(flagServe, server.Handler()); err != nil {
+		printError("failed to serve", err)
+	}
+}
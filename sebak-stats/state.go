@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"boscoin.io/sebak/lib/block"
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/transaction/operation"
+)
+
+// StateAccount is the account in AccountState; the last operation is kept
+// only for the frozen account to check it is unfrozen.
+type StateAccount struct {
+	Balance             common.Amount           `json:"balance"`
+	Linked              string                  `json:"linked,omitempty"`
+	LastOperationType   operation.OperationType `json:"last-operation-type,omitempty"`
+	LastOperationHeight uint64                  `json:"last-operation-height,omitempty"`
+}
+
+// AccountState is the snapshot of all the accounts at the block height. The
+// state is saved in the local `-state-file`, not published and at the next
+// run, only the accounts touched by the block operations after the height are
+// updated instead of getting all the accounts again.
+type AccountState struct {
+	Height   uint64                   `json:"height"`
+	Accounts map[string]*StateAccount `json:"accounts"`
+	Updated  string                   `json:"updated"`
+}
+
+func NewAccountState() *AccountState {
+	return &AccountState{Accounts: map[string]*StateAccount{}}
+}
+
+// loadAccountState reads the account state from `-state-file`; if it is not
+// given, not found or invalid, the empty state is returned and all the
+// accounts will be scanned.
+func loadAccountState() *AccountState {
+	state := NewAccountState()
+
+	if len(flagStateFile) < 1 {
+		log.Debug("-state-file not given; all the accounts will be scanned")
+		return state
+	}
+
+	b, err := ioutil.ReadFile(flagStateFile)
+	if os.IsNotExist(err) {
+		log.Debug("account state not found; all the accounts will be scanned", "file", flagStateFile)
+		return state
+	} else if err != nil {
+		log.Error("failed to read account state", "file", flagStateFile, "error", err)
+		return state
+	}
+
+	if err := json.Unmarshal(b, state); err != nil {
+		log.Error("invalid account state; all the accounts will be scanned", "error", err)
+		return NewAccountState()
+	}
+	if state.Accounts == nil {
+		state.Accounts = map[string]*StateAccount{}
+	}
+
+	log.Debug("account state loaded", "height", state.Height, "accounts", len(state.Accounts))
+
+	return state
+}
+
+func (s *AccountState) Bytes() []byte {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// Save writes the state to `-state-file`; the state is written to the temp
+// file and renamed, so the broken state is not left.
+func (s *AccountState) Save() error {
+	if len(flagStateFile) < 1 {
+		return nil
+	}
+
+	tmp := flagStateFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, s.Bytes(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, flagStateFile)
+}
+
+// Sync brings the state to the block height; the state, which has no height
+// or is ahead of the height is rebuilt by scanning all the accounts.
+func (s *AccountState) Sync(height uint64) error {
+	if s.Height < 1 || s.Height > height {
+		if err := s.scan(height); err != nil {
+			return err
+		}
+	} else if err := s.update(height); err != nil {
+		return err
+	}
+
+	s.Updated = common.NowISO8601()
+
+	return nil
+}
+
+// scan gets all the accounts and the last operation of the frozen accounts.
+func (s *AccountState) scan(height uint64) error {
+	log.Debug("getting all the accounts")
+
+	accounts := map[string]*StateAccount{}
+
+	var cursor []byte
+	for {
+		result, err := getAccounts(cursor)
+		if err != nil {
+			return fmt.Errorf("failed to get accounts: %v", err)
+		}
+		for _, item := range result.Items {
+			var account block.BlockAccount
+			if err := json.Unmarshal(item.Value, &account); err != nil {
+				return fmt.Errorf("invalid value: %v", err)
+			}
+			if _, found := accounts[account.Address]; found {
+				return fmt.Errorf("duplicated key found: %s", account.Address)
+			}
+
+			ac := &StateAccount{Balance: account.Balance, Linked: account.Linked}
+			if len(account.Linked) > 0 {
+				bo, err := getLastBlockOperation(account.Address)
+				if err != nil {
+					log.Crit("failed to get BlockOperation", "address", account.Address, "error", err)
+					return fmt.Errorf("failed to get BlockOperation: %v", err)
+				}
+				ac.LastOperationType = bo.Type
+				ac.LastOperationHeight = bo.Height
+			}
+			accounts[account.Address] = ac
+		}
+
+		if uint64(len(result.Items)) < result.Limit {
+			break
+		}
+		cursor = result.Items[len(result.Items)-1].Key
+	}
+
+	log.Debug("all accounts", "accounts", len(accounts))
+
+	s.Height = height
+	s.Accounts = accounts
+
+	return nil
+}
+
+// update gets the accounts touched by the block operations after the state
+// height; the state is changed only when all the accounts are updated.
+func (s *AccountState) update(height uint64) error {
+	log.Debug("updating accounts", "from", s.Height+1, "to", height)
+
+	// last operation by address
+	touched := map[string]block.BlockOperation{}
+
+	cursor := []byte(block.GetBlockOperationKeyPrefixBlockHeight(s.Height + 1))
+	for {
+		result, err := getBlockOperationsByHeight(cursor)
+		if err != nil {
+			return fmt.Errorf("failed to get block operations: %v", err)
+		}
+
+		for _, item := range result.Items {
+			// the operation of cursor is already updated
+			if bytes.Equal(item.Key, cursor) {
+				continue
+			}
+
+			var hash string
+			if err := json.Unmarshal(item.Value, &hash); err != nil {
+				return fmt.Errorf("invalid value: %v", err)
+			}
+
+			bo, err := getBlockOperation(hash)
+			if err != nil {
+				return fmt.Errorf("failed to get BlockOperation: %s: %v", hash, err)
+			}
+			if bo.Height > height {
+				continue
+			}
+
+			for _, address := range []string{bo.Source, bo.Target} {
+				if len(address) > 0 {
+					touched[address] = bo
+				}
+			}
+		}
+
+		if uint64(len(result.Items)) < result.Limit {
+			break
+		}
+		cursor = result.Items[len(result.Items)-1].Key
+	}
+
+	accounts := map[string]*StateAccount{}
+	for address, bo := range touched {
+		account, err := getAccount(address)
+		if err != nil {
+			return fmt.Errorf("failed to get account: %s: %v", address, err)
+		}
+
+		ac := &StateAccount{Balance: account.Balance, Linked: account.Linked}
+		if len(account.Linked) > 0 {
+			ac.LastOperationType = bo.Type
+			ac.LastOperationHeight = bo.Height
+		}
+		accounts[address] = ac
+	}
+
+	for address, ac := range accounts {
+		s.Accounts[address] = ac
+	}
+	s.Height = height
+
+	log.Debug("accounts updated", "updated", len(accounts), "accounts", len(s.Accounts))
+
+	return nil
+}
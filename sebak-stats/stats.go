@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"boscoin.io/sebak/lib/block"
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/transaction/operation"
+)
+
+// Stats is the statistic information at the block height; the text outputs are
+// published as files and the json outputs are served by the api.
+type Stats struct {
+	Height    uint64
+	Inflation map[operation.OperationType]common.Amount
+	Updated   string
+
+	Total             uint64
+	Circulating       uint64
+	ExcludeAccounts   []block.BlockAccount
+	ExcludeAmount     common.Amount
+	MembershipCount   int
+	FrozenCount       int
+	FrozenAmount      common.Amount
+	UnfrozenCount     int
+	UnfrozenAmount    common.Amount
+	AccountsByBalance []block.BlockAccount
+}
+
+// getExcludeAccounts returns the excluded accounts for circulating supply with
+// their total balance.
+func getExcludeAccounts() (accounts []block.BlockAccount, amount common.Amount, err error) {
+	for _, address := range excludeAddresses {
+		var ac block.BlockAccount
+		if ac, err = getAccount(address); err != nil {
+			err = fmt.Errorf("exclude account, '%s' does not exist: %v", address, err)
+			return
+		}
+		accounts = append(accounts, ac)
+		amount = amount.MustAdd(ac.Balance)
+	}
+
+	return
+}
+
+// collectStats builds the stats from the opened snapshot; the inflation is
+// counted after the given height and the account state is synced to the latest
+// block.
+func collectStats(startHeight uint64, startInflation map[operation.OperationType]common.Amount, state *AccountState) (*Stats, error) {
+	stats := &Stats{Updated: common.NowISO8601()}
+
+	{ // inflation
+		lastHeight, inflation, err := getInflation(startHeight, startInflation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get inflation: %v", err)
+		}
+		log.Debug("inflation amount", "inflation", inflation, "block", lastHeight)
+
+		stats.Height = lastHeight
+		stats.Inflation = inflation
+	}
+
+	if err := state.Sync(stats.Height); err != nil {
+		return nil, err
+	}
+
+	var accountsByBalance []block.BlockAccount
+	{ // frozen account
+		membershipCount := map[string]bool{}
+		var frozen, unfrozen int
+		var frozenAmount, unfrozenAmount common.Amount
+		for address, ac := range state.Accounts {
+			if ac.Balance > common.Amount(0) {
+				accountsByBalance = append(accountsByBalance, block.BlockAccount{
+					Address: address,
+					Balance: ac.Balance,
+					Linked:  ac.Linked,
+				})
+			}
+			if len(ac.Linked) < 1 {
+				continue
+			}
+
+			frozen++
+			frozenAmount = frozenAmount.MustAdd(ac.Balance)
+			membershipCount[ac.Linked] = true
+
+			if ac.LastOperationType != operation.TypeUnfreezingRequest {
+				continue
+			}
+			if stats.Height-ac.LastOperationHeight < common.UnfreezingPeriod {
+				continue
+			}
+			unfrozen++
+			unfrozenAmount = unfrozenAmount.MustAdd(ac.Balance)
+		}
+
+		log.Debug(
+			"all freezing accounts",
+			"all", frozen,
+			"frozen", frozen-unfrozen,
+			"unfrozen", unfrozen,
+			"frozen-amount", frozenAmount-unfrozenAmount,
+			"unfrozen-amount", unfrozenAmount,
+			"membership-count", len(membershipCount),
+		)
+
+		stats.MembershipCount = len(membershipCount)
+		stats.FrozenCount = frozen - unfrozen
+		stats.FrozenAmount = frozenAmount - unfrozenAmount
+		stats.UnfrozenCount = unfrozen
+		stats.UnfrozenAmount = unfrozenAmount
+	}
+
+	{
+		log.Debug("calculating total supply")
+		for _, account := range accountsByBalance {
+			stats.Total += uint64(account.Balance)
+		}
+
+		log.Debug("total balance", "supply", stats.Total)
+
+		excludeAccounts, excludeAmount, err := getExcludeAccounts()
+		if err != nil {
+			return nil, err
+		}
+		stats.ExcludeAccounts = excludeAccounts
+		stats.ExcludeAmount = excludeAmount
+		stats.Circulating = stats.Total - uint64(excludeAmount)
+		log.Debug("circulating supply", "supply", stats.Circulating, "exclude", excludeAmount)
+	}
+
+	log.Debug("sorting top holders")
+	sort.Sort(SortByBalance(accountsByBalance))
+	stats.AccountsByBalance = accountsByBalance
+
+	return stats, nil
+}
+
+func (s *Stats) InflationText() string {
+	return fmt.Sprintf(
+		inflationTemplate,
+		gonToBOS(nodeInfo.Policy.InitialBalance),
+		gonToBOS(s.Inflation[operation.TypeInflation]),
+		gonToBOS(s.Inflation[operation.TypeInflationPF]),
+	)
+}
+
+func (s *Stats) FrozenText() string {
+	return fmt.Sprintf(
+		frozenTemplate,
+		s.MembershipCount,
+		s.FrozenCount,
+		gonToBOS(s.FrozenAmount),
+		s.UnfrozenCount,
+		gonToBOS(s.UnfrozenAmount),
+	)
+}
+
+func (s *Stats) TotalSupplyText() string {
+	return gonToBOS(s.Total)
+}
+
+func (s *Stats) TotalSupplyDetailsText() string {
+	return fmt.Sprintf(totalSupplyDetailsTemplate, s.Height, gonToBOS(s.Total))
+}
+
+func (s *Stats) CirculatingSupplyText() string {
+	return gonToBOS(s.Circulating)
+}
+
+func (s *Stats) CirculatingSupplyDetailsText() string {
+	t := fmt.Sprintf(circulatingDetailsTemplate, gonToBOS(s.Circulating))
+	for _, ac := range s.ExcludeAccounts {
+		t += fmt.Sprintf("\n%s,%s,\"\"", ac.Address, gonToBOS(ac.Balance))
+	}
+
+	return t
+}
+
+// topHolders returns the accounts ordered by balance up to limit; if limit is
+// 0, all the accounts are returned.
+func (s *Stats) topHolders(limit int) []block.BlockAccount {
+	if limit < 1 || limit > len(s.AccountsByBalance) {
+		return s.AccountsByBalance
+	}
+
+	return s.AccountsByBalance[:limit]
+}
+
+func (s *Stats) TopHoldersText(limit int) string {
+	csv := []string{"# order,address,balance"}
+	for i, account := range s.topHolders(limit) {
+		csv = append(csv, fmt.Sprintf(
+			"%d,%s,%s",
+			i,
+			account.Address,
+			gonToBOS(account.Balance),
+		))
+	}
+
+	return strings.Join(csv, "\n")
+}
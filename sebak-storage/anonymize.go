@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/strkey"
+
+	"boscoin.io/sebak/lib/storage"
+)
+
+var addressPattern *regexp.Regexp = regexp.MustCompile(`G[A-Z2-7]{55}`)
+
+// Anonymizer replaces the account addresses with the random addresses; the same
+// address is always replaced with the same random address, so the relations of
+// accounts are kept. The addresses in the base64 encoded json, like the message
+// of transaction and the body of operation are also replaced. Because the
+// hashes and signatures are not calculated again, the anonymized items can not
+// be verified.
+type Anonymizer struct {
+	sync.Mutex
+
+	addresses      map[string]string
+	stripMemo      bool
+	stripSignature bool
+}
+
+func NewAnonymizer(stripMemo, stripSignature bool) *Anonymizer {
+	return &Anonymizer{
+		addresses:      map[string]string{},
+		stripMemo:      stripMemo,
+		stripSignature: stripSignature,
+	}
+}
+
+func (a *Anonymizer) address(address string) (string, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	if n, found := a.addresses[address]; found {
+		return n, nil
+	}
+
+	kp, err := keypair.Random()
+	if err != nil {
+		return "", err
+	}
+
+	a.addresses[address] = kp.Address()
+
+	return kp.Address(), nil
+}
+
+// replace replaces the valid addresses in b.
+func (a *Anonymizer) replace(b []byte) ([]byte, error) {
+	var err error
+	replaced := addressPattern.ReplaceAllFunc(b, func(s []byte) []byte {
+		if err != nil {
+			return s
+		}
+		if _, e := strkey.Decode(strkey.VersionByteAccountID, string(s)); e != nil {
+			return s
+		}
+
+		var n string
+		if n, err = a.address(string(s)); err != nil {
+			return s
+		}
+
+		return []byte(n)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return replaced, nil
+}
+
+// Item returns the anonymized item.
+func (a *Anonymizer) Item(item storage.IterItem) (storage.IterItem, error) {
+	value, err := a.value(item.Value)
+	if err != nil {
+		return item, err
+	}
+
+	key, err := a.replace(item.Key)
+	if err != nil {
+		return item, err
+	}
+
+	item.Key = key
+	item.Value = value
+
+	return item, nil
+}
+
+func (a *Anonymizer) value(b []byte) ([]byte, error) {
+	if !json.Valid(b) {
+		return a.replace(b)
+	}
+
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	w, err := a.walk(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(w)
+}
+
+func (a *Anonymizer) walk(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, i := range t {
+			switch strings.ToLower(k) {
+			case "memo":
+				if a.stripMemo {
+					t[k] = ""
+					continue
+				}
+			case "signature":
+				if a.stripSignature {
+					t[k] = ""
+					continue
+				}
+			}
+
+			w, err := a.walk(i)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = w
+		}
+		return t, nil
+	case []interface{}:
+		for i := range t {
+			w, err := a.walk(t[i])
+			if err != nil {
+				return nil, err
+			}
+			t[i] = w
+		}
+		return t, nil
+	case string:
+		if b, err := base64.StdEncoding.DecodeString(t); err == nil && len(b) > 0 && (b[0] == '{' || b[0] == '[') && json.Valid(b) {
+			n, err := a.value(b)
+			if err != nil {
+				return nil, err
+			}
+			return base64.StdEncoding.EncodeToString(n), nil
+		}
+
+		b, err := a.replace([]byte(t))
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+
+	return v, nil
+}
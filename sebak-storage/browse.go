@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	cmdcommon "boscoin.io/sebak/cmd/sebak/common"
+	"boscoin.io/sebak/lib/storage"
+)
+
+// parseKey parses the key; `<prefix name>:<key>` like `block-hash:<hash>` is
+// converted to the raw key, the other key is used as it is.
+func parseKey(s string) string {
+	if i := strings.Index(s, ":"); i > 0 {
+		if prefix, found := allPrefixesByName[s[:i]]; found {
+			return prefix + s[i+1:]
+		}
+	}
+
+	return s
+}
+
+func parseFlagsGet(args []string) {
+	parseLogging(getCmd)
+
+	{ // check source
+		flagSource = args[0]
+		if err := checkSource(flagSource); err != nil {
+			cmdcommon.PrintFlagsError(getCmd, "<source>", err)
+		}
+	}
+
+	parsedFlags := []interface{}{}
+	parsedFlags = append(parsedFlags, "\n\tlog-level", logLevel)
+	parsedFlags = append(parsedFlags, "\n\tlog-format", flagLogFormat)
+	parsedFlags = append(parsedFlags, "\n\tlog", flagLog)
+	parsedFlags = append(parsedFlags, "\n\tsource", flagSource)
+	parsedFlags = append(parsedFlags, "\n\tkey", args[1])
+	parsedFlags = append(parsedFlags, "\n", "")
+
+	log.Debug("parsed flags:", parsedFlags...)
+}
+
+func parseFlagsScan(args []string) {
+	parseLogging(scanCmd)
+
+	if len(flagPrefix) != 1 {
+		cmdcommon.PrintFlagsError(scanCmd, "--prefix", fmt.Errorf("one prefix must be given"))
+	} else if _, found := allPrefixesByName[flagPrefix[0]]; !found {
+		cmdcommon.PrintFlagsError(scanCmd, "--prefix", fmt.Errorf("unknown prefix found: %v", flagPrefix[0]))
+	}
+
+	if flagScanLimit < 1 {
+		cmdcommon.PrintFlagsError(scanCmd, "--limit", fmt.Errorf("must be greater than 0"))
+	}
+
+	{ // check source
+		flagSource = args[0]
+		if err := checkSource(flagSource); err != nil {
+			cmdcommon.PrintFlagsError(scanCmd, "<source>", err)
+		}
+	}
+
+	parsedFlags := []interface{}{}
+	parsedFlags = append(parsedFlags, "\n\tlog-level", logLevel)
+	parsedFlags = append(parsedFlags, "\n\tlog-format", flagLogFormat)
+	parsedFlags = append(parsedFlags, "\n\tlog", flagLog)
+	parsedFlags = append(parsedFlags, "\n\tsource", flagSource)
+	parsedFlags = append(parsedFlags, "\n\tprefix", flagPrefix)
+	parsedFlags = append(parsedFlags, "\n\tlimit", flagScanLimit)
+	parsedFlags = append(parsedFlags, "\n\treverse", flagReverse)
+	parsedFlags = append(parsedFlags, "\n\tstart-key", flagStartKey)
+	parsedFlags = append(parsedFlags, "\n", "")
+
+	log.Debug("parsed flags:", parsedFlags...)
+}
+
+// printItem prints the item with the value decoded by prefix.
+func printItem(item storage.IterItem) error {
+	prefix := string(item.Key[:1])
+	if _, found := allPrefixesWithName[prefix]; !found {
+		b, err := json.MarshalIndent(item, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	decoded, err := NewDecodedItem(prefix, item)
+	if err != nil {
+		return fmt.Errorf("failed to decode value: %s: %v", keyString(item.Key), err)
+	}
+
+	b, err := json.MarshalIndent(decoded, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+
+	return nil
+}
+
+func get(key string) bool {
+	defer source.Close()
+
+	if err := source.OpenSnapshot(); err != nil {
+		log.Error("failed to OpenSnapshot", "error", err)
+		return false
+	}
+	defer source.ReleaseSnapshot()
+
+	k := parseKey(key)
+	if len(k) < 1 {
+		log.Error("empty key")
+		return false
+	}
+
+	b, err := source.Get(k)
+	if err != nil {
+		log.Error("failed to get", "key", keyString([]byte(k)), "error", err)
+		return false
+	}
+
+	if err := printItem(storage.IterItem{Key: []byte(k), Value: b}); err != nil {
+		log.Error("failed to print", "key", keyString([]byte(k)), "error", err)
+		return false
+	}
+
+	return true
+}
+
+func scan() bool {
+	defer source.Close()
+
+	if err := source.OpenSnapshot(); err != nil {
+		log.Error("failed to OpenSnapshot", "error", err)
+		return false
+	}
+	defer source.ReleaseSnapshot()
+
+	prefix := allPrefixesByName[flagPrefix[0]]
+
+	var cursor []byte
+	if len(flagStartKey) > 0 {
+		cursor = []byte(prefix + flagStartKey)
+	}
+
+	items, err := source.GetIterator(prefix, cursor, flagReverse, flagScanLimit)
+	if err != nil {
+		log.Error("failed to scan", "prefix", flagPrefix[0], "error", err)
+		return false
+	}
+
+	for _, item := range items {
+		if err := printItem(item); err != nil {
+			log.Error("failed to print", "key", keyString(item.Key), "error", err)
+			return false
+		}
+	}
+	log.Debug("scan finished", "prefix", flagPrefix[0], "count", len(items))
+
+	return true
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"boscoin.io/sebak/lib/block"
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/storage"
+)
+
+const checkpointFileName string = "checkpoint.json"
+
+// cursorPrefixes can be resumed from the last key, their keys only grow with
+// the block height. The other prefixes are dumped again or limited by
+// `--since-height`.
+var cursorPrefixes map[string]bool = map[string]bool{
+	common.BlockPrefixHeight:               true,
+	common.BlockOperationPrefixBlockHeight: true,
+}
+
+// heightPrefixes are limited by `--since-height`; the value of keyed prefix is
+// found in the key, the others have the hash as value.
+var heightPrefixes map[string]string = map[string]string{
+	common.BlockPrefixHash:                  "block",
+	common.BlockPrefixConfirmed:             "block",
+	common.BlockPrefixHeight:                "block",
+	common.BlockTransactionPrefixHash:       "transaction",
+	common.BlockTransactionPrefixSource:     "transaction",
+	common.BlockTransactionPrefixConfirmed:  "transaction",
+	common.BlockTransactionPrefixAccount:    "transaction",
+	common.BlockTransactionPrefixBlock:      "transaction",
+	common.TransactionPoolPrefix:            "transaction",
+	common.BlockOperationPrefixHash:         "operation",
+	common.BlockOperationPrefixTxHash:       "operation",
+	common.BlockOperationPrefixSource:       "operation",
+	common.BlockOperationPrefixTarget:       "operation",
+	common.BlockOperationPrefixPeers:        "operation",
+	common.BlockOperationPrefixTypeSource:   "operation",
+	common.BlockOperationPrefixTypeTarget:   "operation",
+	common.BlockOperationPrefixTypePeers:    "operation",
+	common.BlockOperationPrefixCreateFrozen: "operation",
+	common.BlockOperationPrefixFrozenLinked: "operation",
+	common.BlockOperationPrefixBlockHeight:  "operation",
+}
+
+// appendedPrefix checks the dumped items of prefix are appended to the files of
+// the last dump. With `--incremental`, only the new items of the cursor
+// prefixes and the prefixes limited by `--since-height` are dumped; the other
+// prefixes are dumped again from the first key, so their files are rewritten.
+func appendedPrefix(prefix string) bool {
+	if !flagIncremental {
+		return false
+	} else if cursorPrefixes[prefix] {
+		return true
+	}
+
+	_, found := heightPrefixes[prefix]
+	return found && flagSinceHeight > 0
+}
+
+var keyedHeightPrefixes map[string]bool = map[string]bool{
+	common.BlockPrefixHash:            true,
+	common.BlockTransactionPrefixHash: true,
+	common.TransactionPoolPrefix:      true,
+	common.BlockOperationPrefixHash:   true,
+}
+
+// Checkpoint keeps the last dumped key by prefix name and the block height of
+// the last dump. Failed is set when the last dump is not finished; the height
+// prefixes of it may be partially appended, so they are rewritten by the next
+// dump.
+type Checkpoint struct {
+	sync.RWMutex
+
+	Height  uint64            `json:"height"`
+	Keys    map[string][]byte `json:"keys"`
+	Failed  bool              `json:"failed,omitempty"`
+	Updated string            `json:"updated"`
+}
+
+func loadCheckpoint(directory string) (*Checkpoint, error) {
+	cp := &Checkpoint{Keys: map[string][]byte{}}
+
+	b, err := ioutil.ReadFile(filepath.Join(directory, checkpointFileName))
+	if os.IsNotExist(err) {
+		return cp, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, cp); err != nil {
+		return nil, err
+	}
+	if cp.Keys == nil {
+		cp.Keys = map[string][]byte{}
+	}
+
+	return cp, nil
+}
+
+func (c *Checkpoint) Save(store FileStore) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.Updated = common.NowISO8601()
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return store.WriteFile(checkpointFileName, b)
+}
+
+func (c *Checkpoint) Cursor(prefix string) []byte {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.Keys[allPrefixesWithName[prefix]]
+}
+
+func (c *Checkpoint) SetCursor(prefix string, key []byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.Keys[allPrefixesWithName[prefix]] = key
+}
+
+// HeightFilter knows the hashes of the blocks, transactions and operations,
+// which are stored after the given height.
+type HeightFilter struct {
+	height       uint64
+	blocks       map[string]bool
+	transactions map[string]bool
+	operations   map[string]bool
+}
+
+func NewHeightFilter(height uint64) (*HeightFilter, error) {
+	hf := &HeightFilter{
+		height:       height,
+		blocks:       map[string]bool{},
+		transactions: map[string]bool{},
+		operations:   map[string]bool{},
+	}
+
+	cursor := []byte(block.GetBlockKeyPrefixHeight(height))
+	err := source.Walk(common.BlockPrefixHeight, cursor, func(item storage.IterItem) (bool, error) {
+		var hash string
+		if err := json.Unmarshal(item.Value, &hash); err != nil {
+			return false, err
+		}
+		hf.blocks[hash] = true
+
+		b, err := source.Get(fmt.Sprintf("%s%s", common.BlockPrefixHash, hash))
+		if err != nil {
+			return false, err
+		}
+
+		var blk block.Block
+		if err := json.Unmarshal(b, &blk); err != nil {
+			return false, err
+		}
+
+		hashes := blk.Transactions
+		if len(blk.ProposerTransaction) > 0 {
+			hashes = append(hashes, blk.ProposerTransaction)
+		}
+
+		for _, h := range hashes {
+			hf.transactions[h] = true
+
+			b, err := source.Get(fmt.Sprintf("%s%s", common.BlockTransactionPrefixHash, h))
+			if err != nil {
+				return false, err
+			}
+
+			var bt block.BlockTransaction
+			if err := json.Unmarshal(b, &bt); err != nil {
+				return false, err
+			}
+			for _, o := range bt.Operations {
+				hf.operations[o] = true
+			}
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug(
+		"height filter loaded",
+		"height", height,
+		"blocks", len(hf.blocks),
+		"transactions", len(hf.transactions),
+		"operations", len(hf.operations),
+	)
+
+	return hf, nil
+}
+
+// Filter returns true when the item belongs to the blocks after the height.
+// The items of the prefixes, which are not related with block height are
+// always passed.
+func (h *HeightFilter) Filter(prefix string, item storage.IterItem) bool {
+	kind, found := heightPrefixes[prefix]
+	if !found {
+		return true
+	}
+
+	var hash string
+	if keyedHeightPrefixes[prefix] {
+		hash = string(item.Key[len(prefix):])
+	} else if err := json.Unmarshal(item.Value, &hash); err != nil {
+		log.Error("failed to parse hash value", "error", err, "prefix", allPrefixesWithName[prefix])
+		return false
+	}
+
+	switch kind {
+	case "block":
+		return h.blocks[hash]
+	case "transaction":
+		return h.transactions[hash]
+	case "operation":
+		return h.operations[hash]
+	}
+
+	return true
+}
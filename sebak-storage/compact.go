@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	cmdcommon "boscoin.io/sebak/cmd/sebak/common"
+)
+
+func parseFlagsCompact(args []string) {
+	parseLogging(compactCmd)
+
+	if compactCmd.Flags().Changed("prefix") {
+		parseFlagPrefix(compactCmd)
+	}
+
+	if len(flagStartKey) > 0 && len(flagEndKey) > 0 && flagStartKey >= flagEndKey {
+		cmdcommon.PrintFlagsError(compactCmd, "--end-key", fmt.Errorf("must be greater than --start-key"))
+	}
+
+	{ // check source
+		d, err := sourceDirectory(args[0])
+		if err != nil {
+			cmdcommon.PrintFlagsError(compactCmd, "<db directory>", err)
+		}
+		flagSource = d
+
+		st, err := checkSourceDirectory(flagSource)
+		if err != nil {
+			cmdcommon.PrintFlagsError(compactCmd, "<db directory>", err)
+		}
+		stLocal = st
+	}
+
+	parsedFlags := []interface{}{}
+	parsedFlags = append(parsedFlags, "\n\tlog-level", logLevel)
+	parsedFlags = append(parsedFlags, "\n\tlog-format", flagLogFormat)
+	parsedFlags = append(parsedFlags, "\n\tlog", flagLog)
+	parsedFlags = append(parsedFlags, "\n\tsource", flagSource)
+	parsedFlags = append(parsedFlags, "\n\tprefix", flagPrefix)
+	parsedFlags = append(parsedFlags, "\n\tstart-key", flagStartKey)
+	parsedFlags = append(parsedFlags, "\n\tend-key", flagEndKey)
+	parsedFlags = append(parsedFlags, "\n", "")
+
+	log.Debug("parsed flags:", parsedFlags...)
+}
+
+// compactRanges returns the key ranges to be compacted; without `--prefix`,
+// `--start-key` and `--end-key` are the whole key, otherwise they are the key
+// without prefix.
+func compactRanges() []util.Range {
+	if len(flagPrefix) < 1 {
+		r := util.Range{}
+		if len(flagStartKey) > 0 {
+			r.Start = []byte(flagStartKey)
+		}
+		if len(flagEndKey) > 0 {
+			r.Limit = []byte(flagEndKey)
+		}
+
+		return []util.Range{r}
+	}
+
+	var ranges []util.Range
+	for _, name := range flagPrefix {
+		prefix := allPrefixesByName[name]
+		r := *util.BytesPrefix([]byte(prefix))
+		if len(flagStartKey) > 0 {
+			r.Start = []byte(prefix + flagStartKey)
+		}
+		if len(flagEndKey) > 0 {
+			r.Limit = []byte(prefix + flagEndKey)
+		}
+		ranges = append(ranges, r)
+	}
+
+	return ranges
+}
+
+func compact() bool {
+	defer stLocal.Close()
+
+	before, err := directorySize(flagSource)
+	if err != nil {
+		log.Error("failed to get size of storage", "error", err)
+		return false
+	}
+
+	for _, r := range compactRanges() {
+		log.Debug("compacting", "start", keyString(r.Start), "limit", keyString(r.Limit))
+		if err := stLocal.DB.CompactRange(r); err != nil {
+			log.Error("failed to compact", "error", err, "start", keyString(r.Start), "limit", keyString(r.Limit))
+			return false
+		}
+	}
+
+	after, err := directorySize(flagSource)
+	if err != nil {
+		log.Error("failed to get size of storage", "error", err)
+		return false
+	}
+
+	fmt.Printf("before\t%d\nafter\t%d\nreduced\t%d\n", before, after, before-after)
+
+	return true
+}
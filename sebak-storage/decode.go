@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+
+	"boscoin.io/sebak/lib/block"
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/storage"
+	"boscoin.io/sebak/lib/transaction"
+)
+
+// DecodedItem is the storage item, which value is decoded by prefix.
+type DecodedItem struct {
+	Prefix string      `json:"prefix"`
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+}
+
+func NewDecodedItem(prefix string, item storage.IterItem) (DecodedItem, error) {
+	value, err := decodeValue(prefix, item.Value)
+	if err != nil {
+		return DecodedItem{}, err
+	}
+
+	return DecodedItem{
+		Prefix: allPrefixesWithName[prefix],
+		Key:    string(item.Key[len(prefix):]),
+		Value:  value,
+	}, nil
+}
+
+// decodeValue decodes the value into the SEBAK type of prefix. The values of
+// index prefixes are the hash string and the unknown values are kept as raw
+// json.
+func decodeValue(prefix string, b []byte) (interface{}, error) {
+	switch prefix {
+	case common.BlockPrefixHash:
+		var blk block.Block
+		if err := json.Unmarshal(b, &blk); err != nil {
+			return nil, err
+		}
+		return blk, nil
+	case common.BlockTransactionPrefixHash:
+		var bt block.BlockTransaction
+		if err := json.Unmarshal(b, &bt); err != nil {
+			return nil, err
+		}
+		return bt, nil
+	case common.BlockOperationPrefixHash:
+		var bo block.BlockOperation
+		if err := json.Unmarshal(b, &bo); err != nil {
+			return nil, err
+		}
+		return bo, nil
+	case common.BlockAccountPrefixAddress:
+		var ac block.BlockAccount
+		if err := json.Unmarshal(b, &ac); err != nil {
+			return nil, err
+		}
+		return ac, nil
+	case common.BlockAccountSequenceIDPrefix, common.BlockAccountSequenceIDByAddressPrefix:
+		var bas block.BlockAccountSequenceID
+		if err := json.Unmarshal(b, &bas); err != nil {
+			return nil, err
+		}
+		return bas, nil
+	case common.TransactionPoolPrefix:
+		var tp block.TransactionPool
+		if err := json.Unmarshal(b, &tp); err != nil {
+			return nil, err
+		}
+
+		var tx transaction.Transaction
+		if err := json.Unmarshal(tp.Message, &tx); err != nil {
+			return nil, err
+		}
+		return tx, nil
+	}
+
+	if _, found := indexPrefixes[prefix]; found {
+		var hash string
+		if err := json.Unmarshal(b, &hash); err != nil {
+			return nil, err
+		}
+		return hash, nil
+	}
+
+	if json.Valid(b) {
+		return json.RawMessage(b), nil
+	}
+
+	return b, nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	cmdcommon "boscoin.io/sebak/cmd/sebak/common"
+	"boscoin.io/sebak/lib/node/runner"
+	"boscoin.io/sebak/lib/storage"
+)
+
+// DiffResult counts the differing keys of one prefix.
+type DiffResult struct {
+	Prefix  string `json:"prefix"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Changed int    `json:"changed"`
+	Same    int    `json:"same"`
+}
+
+func (d DiffResult) IsSame() bool {
+	return d.Added+d.Removed+d.Changed < 1
+}
+
+// DiffItem is the differing key; `added` is only in <source-b>, `removed` is
+// only in <source-a>.
+type DiffItem struct {
+	Prefix string `json:"prefix"`
+	Status string `json:"status"`
+	Key    string `json:"key"`
+	A      []byte `json:"a,omitempty"`
+	B      []byte `json:"b,omitempty"`
+}
+
+// ItemCursor reads the items of prefix from the source page by page in key
+// order.
+type ItemCursor struct {
+	source *Source
+	prefix string
+	cursor []byte
+	items  []storage.IterItem
+	done   bool
+}
+
+func NewItemCursor(source *Source, prefix string) *ItemCursor {
+	return &ItemCursor{source: source, prefix: prefix}
+}
+
+func (c *ItemCursor) fetch() error {
+	limit := runner.MaxLimitListOptions
+	for len(c.items) < 1 && !c.done {
+		items, err := c.source.GetIterator(c.prefix, c.cursor, false, limit)
+		if err != nil {
+			return err
+		}
+
+		if len(items) < int(limit) {
+			c.done = true
+		}
+
+		for _, item := range items {
+			if c.cursor != nil && bytes.Equal(item.Key, c.cursor) {
+				continue
+			}
+			c.items = append(c.items, item)
+		}
+
+		if len(items) > 0 {
+			c.cursor = items[len(items)-1].Key
+		}
+	}
+
+	return nil
+}
+
+// Peek returns the current item; nil means no more items.
+func (c *ItemCursor) Peek() (*storage.IterItem, error) {
+	if err := c.fetch(); err != nil {
+		return nil, err
+	}
+
+	if len(c.items) < 1 {
+		return nil, nil
+	}
+
+	return &c.items[0], nil
+}
+
+func (c *ItemCursor) Pop() {
+	if len(c.items) > 0 {
+		c.items = c.items[1:]
+	}
+}
+
+func parseFlagsDiff(args []string) {
+	parseFlagPrefix(diffCmd)
+	parseLogging(diffCmd)
+
+	{ // output format
+		switch flagDiffFormat {
+		case "summary":
+		case "jsonl":
+		default:
+			cmdcommon.PrintFlagsError(diffCmd, "--format", fmt.Errorf("unknown output format found"))
+		}
+	}
+
+	{ // check sources
+		var err error
+		if source, err = NewSource(args[0]); err != nil {
+			cmdcommon.PrintFlagsError(diffCmd, "<source-a>", err)
+		}
+		if sourceB, err = NewSource(args[1]); err != nil {
+			cmdcommon.PrintFlagsError(diffCmd, "<source-b>", err)
+		}
+	}
+
+	parsedFlags := []interface{}{}
+	parsedFlags = append(parsedFlags, "\n\tlog-level", logLevel)
+	parsedFlags = append(parsedFlags, "\n\tlog-format", flagLogFormat)
+	parsedFlags = append(parsedFlags, "\n\tlog", flagLog)
+	parsedFlags = append(parsedFlags, "\n\tsource-a", args[0])
+	parsedFlags = append(parsedFlags, "\n\tsource-b", args[1])
+	parsedFlags = append(parsedFlags, "\n\tprefix", flagPrefix)
+	parsedFlags = append(parsedFlags, "\n\tformat", flagDiffFormat)
+	parsedFlags = append(parsedFlags, "\n", "")
+
+	log.Debug("parsed flags:", parsedFlags...)
+}
+
+func printDiffItem(item DiffItem) {
+	if flagDiffFormat != "jsonl" {
+		return
+	}
+
+	b, err := json.Marshal(item)
+	if err != nil {
+		cmdcommon.PrintError(diffCmd, fmt.Errorf("failed to marshal DiffItem: %v", err))
+	}
+	fmt.Println(string(b))
+}
+
+func diffPrefix(prefix string) (result DiffResult, err error) {
+	name := allPrefixesWithName[prefix]
+	result.Prefix = name
+
+	a := NewItemCursor(source, prefix)
+	b := NewItemCursor(sourceB, prefix)
+
+	var ia, ib *storage.IterItem
+	for {
+		if ia, err = a.Peek(); err != nil {
+			return
+		}
+		if ib, err = b.Peek(); err != nil {
+			return
+		}
+
+		if ia == nil && ib == nil {
+			break
+		}
+
+		var c int
+		if ia == nil {
+			c = 1
+		} else if ib == nil {
+			c = -1
+		} else {
+			c = bytes.Compare(ia.Key, ib.Key)
+		}
+
+		switch {
+		case c < 0:
+			result.Removed += 1
+			printDiffItem(DiffItem{Prefix: name, Status: "removed", Key: keyString(ia.Key), A: ia.Value})
+			a.Pop()
+		case c > 0:
+			result.Added += 1
+			printDiffItem(DiffItem{Prefix: name, Status: "added", Key: keyString(ib.Key), B: ib.Value})
+			b.Pop()
+		default:
+			if bytes.Equal(ia.Value, ib.Value) {
+				result.Same += 1
+			} else {
+				result.Changed += 1
+				printDiffItem(DiffItem{Prefix: name, Status: "changed", Key: keyString(ia.Key), A: ia.Value, B: ib.Value})
+			}
+			a.Pop()
+			b.Pop()
+		}
+	}
+
+	return
+}
+
+// diff returns false when the differences are found.
+func diff() bool {
+	defer func() {
+		if source != nil {
+			source.Close()
+		}
+		if sourceB != nil {
+			sourceB.Close()
+		}
+	}()
+
+	if err := source.OpenSnapshot(); err != nil {
+		log.Error("failed to OpenSnapshot", "source", "a", "error", err)
+		return false
+	}
+	if err := sourceB.OpenSnapshot(); err != nil {
+		log.Error("failed to OpenSnapshot", "source", "b", "error", err)
+		return false
+	}
+
+	var same bool = true
+	for _, name := range flagPrefix {
+		result, err := diffPrefix(allPrefixesByName[name])
+		if err != nil {
+			log.Error("failed to diff", "prefix", name, "error", err)
+			return false
+		}
+		log.Debug("diff finished", "result", result)
+
+		if !result.IsSame() {
+			same = false
+		}
+
+		if flagDiffFormat == "summary" {
+			fmt.Printf(
+				"%-34s added=%d removed=%d changed=%d same=%d\n",
+				name,
+				result.Added,
+				result.Removed,
+				result.Changed,
+				result.Same,
+			)
+		}
+	}
+
+	return same
+}
@@ -5,10 +5,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
 	"sync"
-
-	jsonrpc "github.com/gorilla/rpc/json"
+	"time"
 
 	cmdcommon "boscoin.io/sebak/cmd/sebak/common"
 	"boscoin.io/sebak/lib/node/runner"
@@ -56,46 +56,79 @@ func parseFlagsDump(args []string) {
 		cmdcommon.PrintError(dumpCmd, nil)
 	}
 
-	{ // make allPrefixesByName
-		allPrefixesByName = map[string]string{}
-		for prefix, name := range allPrefixesWithName {
-			allPrefixesByName[name] = prefix
-		}
+	parseFlagPrefix(dumpCmd)
+
+	if args[1] == streamPath {
+		// the items are written to stdout
+		logStream = os.Stderr
 	}
+	parseLogging(dumpCmd)
 
-	{ // prefix
-		if len(flagPrefix) < 1 {
-			flagPrefix = append(flagPrefix, "all")
+	{ // output format
+		switch flagOutputFormat {
+		case "leveldb":
+		case "json":
+		case "json-decoded":
+		case "jsonl":
+			if args[1] != streamPath {
+				cmdcommon.PrintFlagsError(dumpCmd, "--format", fmt.Errorf("jsonl can be dumped only to stdout, '-'"))
+			}
+		case "sqlite":
+			// only the prefixes of sql tables are dumped
+			var prefixes ListFlags
+			for _, name := range flagPrefix {
+				if _, found := sqlitePrefixes[allPrefixesByName[name]]; found {
+					prefixes = append(prefixes, name)
+				}
+			}
+			if len(prefixes) < 1 {
+				cmdcommon.PrintFlagsError(dumpCmd, "--prefix", fmt.Errorf("prefixes for sqlite not found"))
+			}
+			flagPrefix = prefixes
+		default:
+			cmdcommon.PrintFlagsError(dumpCmd, "--format", fmt.Errorf("unknown output format found"))
 		}
+	}
 
-		var all bool
-		for _, prefix := range flagPrefix {
-			if prefix == "all" {
-				all = true
-				continue
-			}
+	if flagRetry < 0 {
+		cmdcommon.PrintFlagsError(dumpCmd, "--retry", fmt.Errorf("must not be negative"))
+	}
 
-			if _, found := allPrefixesByName[prefix]; !found {
-				cmdcommon.PrintFlagsError(dumpCmd, "--prefix", fmt.Errorf("unknown prefix found: %v", prefix))
-			}
+	if flagWorkers < 1 {
+		cmdcommon.PrintFlagsError(dumpCmd, "--workers", fmt.Errorf("should be over 0"))
+	}
+
+	{ // anonymize
+		if (flagStripMemo || flagStripSignature) && !flagAnonymize {
+			cmdcommon.PrintFlagsError(dumpCmd, "--anonymize", fmt.Errorf("--strip-memo and --strip-signature need --anonymize"))
 		}
 
-		if all {
-			flagPrefix = ListFlags{}
-			for _, name := range allPrefixesWithName {
-				flagPrefix = append(flagPrefix, name)
-			}
+		if flagAnonymize {
+			anonymizer = NewAnonymizer(flagStripMemo, flagStripSignature)
 		}
 	}
 
-	parseLogging(dumpCmd)
+	{ // key filter
+		if len(flagStartKey) > 0 && len(flagEndKey) > 0 && flagStartKey >= flagEndKey {
+			cmdcommon.PrintFlagsError(dumpCmd, "--end-key", fmt.Errorf("must be greater than --start-key"))
+		}
 
-	{ // output format
-		switch flagOutputFormat {
-		case "leveldb":
-		case "json":
-		default:
-			cmdcommon.PrintFlagsError(dumpCmd, "--format", fmt.Errorf("unknown output format found"))
+		if len(flagAddress) > 0 {
+			// only the prefixes, which are related with address are dumped
+			var prefixes ListFlags
+			for _, name := range flagPrefix {
+				if isAddressPrefix(name) {
+					prefixes = append(prefixes, name)
+				}
+			}
+			if len(prefixes) < 1 {
+				cmdcommon.PrintFlagsError(dumpCmd, "--prefix", fmt.Errorf("prefixes for --address not found"))
+			}
+			flagPrefix = prefixes
+		}
+
+		if len(flagStartKey) > 0 || len(flagEndKey) > 0 || flagLimit > 0 || len(flagAddress) > 0 {
+			keyFilter = NewKeyFilter(flagStartKey, flagEndKey, flagLimit, flagAddress)
 		}
 	}
 
@@ -109,7 +142,39 @@ func parseFlagsDump(args []string) {
 	{ // checkout output
 		flagOutput = args[1]
 
-		if _, err := os.Stat(flagOutput); !os.IsNotExist(err) {
+		if flagOutput == streamPath {
+			if flagOutputFormat != "jsonl" {
+				cmdcommon.PrintFlagsError(dumpCmd, "--format", fmt.Errorf("only jsonl can be dumped to stdout"))
+			}
+			if flagIncremental {
+				cmdcommon.PrintFlagsError(dumpCmd, "--incremental", fmt.Errorf("can not be used with stdout"))
+			}
+		}
+
+		if isS3Output(flagOutput) {
+			if flagOutputFormat != "json" && flagOutputFormat != "json-decoded" {
+				cmdcommon.PrintFlagsError(dumpCmd, "--format", fmt.Errorf("only json formats can be dumped to s3"))
+			}
+			if flagIncremental {
+				cmdcommon.PrintFlagsError(dumpCmd, "--incremental", fmt.Errorf("can not be used with s3"))
+			}
+		}
+
+		if flagIncremental && flagForce {
+			cmdcommon.PrintFlagsError(dumpCmd, "--incremental", fmt.Errorf("can not be used with --force"))
+		}
+
+		if flagIncremental && flagAnonymize {
+			cmdcommon.PrintFlagsError(dumpCmd, "--incremental", fmt.Errorf("can not be used with --anonymize"))
+		}
+
+		if flagIncremental && keyFilter != nil {
+			cmdcommon.PrintFlagsError(dumpCmd, "--incremental", fmt.Errorf("can not be used with --start-key, --end-key, --limit and --address"))
+		}
+
+		if isS3Output(flagOutput) || flagOutput == streamPath {
+			// files of s3 are overwritten
+		} else if _, err := os.Stat(flagOutput); !os.IsNotExist(err) && !flagIncremental {
 			d, err := os.Open(flagOutput)
 			if err != nil {
 				cmdcommon.PrintFlagsError(dumpCmd, "<output directory>", err)
@@ -131,23 +196,82 @@ func parseFlagsDump(args []string) {
 			}
 		}
 
-		if flagOutputFormat == "leveldb" {
+		if flagOutput == streamPath {
+			// checkpoint and manifest are not saved
+		} else if isS3Output(flagOutput) {
+			if s, err := NewS3FileStore(flagOutput, flagS3Region, flagS3Endpoint); err != nil {
+				cmdcommon.PrintFlagsError(dumpCmd, "<output directory>", err)
+			} else {
+				fileStore = s
+			}
+		} else {
+			fileStore = NewLocalFileStore(flagOutput)
+		}
+
+		if flagOutputFormat == "jsonl" {
+			outputSink = NewStreamSink(os.Stdout)
+		} else if flagOutputFormat == "leveldb" {
 			if storageConfig, err := storage.NewConfigFromString("file://" + flagOutput); err != nil {
 				cmdcommon.PrintFlagsError(dumpCmd, "<output directory>", err)
 			} else {
 				if st, err := storage.NewStorage(storageConfig); err != nil {
 					cmdcommon.PrintFlagsError(dumpCmd, "<output directory>", err)
 				} else {
-					stOutput = st
+					outputSink = NewLevelDBSink(st)
 				}
 			}
-		} else if flagOutputFormat == "json" {
+		} else if flagOutputFormat == "json" || flagOutputFormat == "json-decoded" {
 			// create new directory
+			if !isS3Output(flagOutput) {
+				if err := os.MkdirAll(flagOutput, 0700); err != nil {
+					cmdcommon.PrintFlagsError(dumpCmd, "<output directory>", err)
+				}
+			}
+
+			outputSink = NewJSONSink(fileStore, flagOutputFormat == "json-decoded")
+		} else if flagOutputFormat == "sqlite" {
 			if err := os.MkdirAll(flagOutput, 0700); err != nil {
 				cmdcommon.PrintFlagsError(dumpCmd, "<output directory>", err)
 			}
 
-			jsonFiles = &sync.Map{}
+			if w, err := NewSQLiteWriter(flagOutput); err != nil {
+				cmdcommon.PrintFlagsError(dumpCmd, "<output directory>", err)
+			} else {
+				outputSink = w
+			}
+		}
+	}
+
+	{ // checkpoint
+		checkpoint = &Checkpoint{Keys: map[string][]byte{}}
+		if flagIncremental {
+			if cp, err := loadCheckpoint(flagOutput); err != nil {
+				cmdcommon.PrintFlagsError(dumpCmd, "--incremental", err)
+			} else {
+				checkpoint = cp
+			}
+
+			// after the failed dump, the prefixes limited by height are dumped
+			// again from the first key and their files are rewritten.
+			if checkpoint.Failed {
+				if dumpCmd.Flags().Changed("since-height") {
+					cmdcommon.PrintFlagsError(dumpCmd, "--since-height", fmt.Errorf("can not be used after the failed dump"))
+				}
+				flagSinceHeight = 0
+			} else if !dumpCmd.Flags().Changed("since-height") {
+				flagSinceHeight = checkpoint.Height
+			}
+		}
+	}
+
+	{ // manifest
+		manifest = NewManifest()
+		if flagIncremental {
+			if m, err := loadManifest(flagOutput); err != nil && !os.IsNotExist(err) {
+				cmdcommon.PrintFlagsError(dumpCmd, "--incremental", err)
+			} else if err == nil {
+				manifest = m
+			}
 		}
 	}
 
@@ -158,23 +282,83 @@ func parseFlagsDump(args []string) {
 	parsedFlags = append(parsedFlags, "\n\tforce", flagForce)
 	parsedFlags = append(parsedFlags, "\n\tsource", flagSource)
 	parsedFlags = append(parsedFlags, "\n\toutput", flagOutput)
-	parsedFlags = append(parsedFlags, "\n\tjsonRPCEndpoint", jsonRPCEndpoint)
 	parsedFlags = append(parsedFlags, "\n\tprefix", flagPrefix)
 	parsedFlags = append(parsedFlags, "\n\toutput-format", flagOutputFormat)
+	parsedFlags = append(parsedFlags, "\n\tincremental", flagIncremental)
+	parsedFlags = append(parsedFlags, "\n\tsince-height", flagSinceHeight)
+	parsedFlags = append(parsedFlags, "\n\tnetwork-id", flagNetworkID)
+	parsedFlags = append(parsedFlags, "\n\tretry", flagRetry)
+	parsedFlags = append(parsedFlags, "\n\tworkers", flagWorkers)
+	parsedFlags = append(parsedFlags, "\n\tsnapshot-keep-alive", flagSnapshotKeepAlive)
+	parsedFlags = append(parsedFlags, "\n\tanonymize", flagAnonymize)
+	parsedFlags = append(parsedFlags, "\n\tstrip-memo", flagStripMemo)
+	parsedFlags = append(parsedFlags, "\n\tstrip-signature", flagStripSignature)
+	parsedFlags = append(parsedFlags, "\n\tstart-key", flagStartKey)
+	parsedFlags = append(parsedFlags, "\n\tend-key", flagEndKey)
+	parsedFlags = append(parsedFlags, "\n\tlimit", flagLimit)
+	parsedFlags = append(parsedFlags, "\n\taddress", flagAddress)
 	parsedFlags = append(parsedFlags, "\n", "")
 
 	log.Debug("parsed flags:", parsedFlags...)
 }
 
-func dumpSource(prefix string) {
+// dumpCursor returns the cursor to start; with `--incremental`, the prefix,
+// which can be resumed starts after the last dumped key. With `--start-key`,
+// the prefix starts from the start key.
+func dumpCursor(prefix string) []byte {
+	if keyFilter != nil {
+		return keyFilter.Cursor(prefix)
+	}
+
+	if !flagIncremental || !cursorPrefixes[prefix] {
+		return nil
+	}
+
+	return checkpoint.Cursor(prefix)
+}
+
+// addDumpedCount records the number of dumped items in manifest; the count of
+// the rewritten prefix is replaced.
+func addDumpedCount(prefix string, count int) {
+	if appendedPrefix(prefix) {
+		manifest.AddCount(prefix, count)
+	} else {
+		manifest.SetCount(prefix, count)
+	}
+}
+
+func saveDumpedItem(prefix string, item storage.IterItem) (bool, error) {
+	if heightFilter != nil && !heightFilter.Filter(prefix, item) {
+		return false, nil
+	}
+
+	if keyFilter != nil && !keyFilter.Filter(prefix, item) {
+		return false, nil
+	}
+
+	if anonymizer != nil {
+		var err error
+		if item, err = anonymizer.Item(item); err != nil {
+			return false, fmt.Errorf("failed to anonymize: %s: %v", keyString(item.Key), err)
+		}
+	}
+
+	if err := saveItemToOutput(prefix, item); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func dumpSource(prefix string) error {
 	limit := runner.MaxLimitListOptions
 
-	var cursor []byte
-	var allCount int
+	cursor := dumpCursor(prefix)
+	var allCount, savedCount int
 end:
 	for {
 		var count int
-		it, closeFunc := stSource.GetIterator(
+		it, closeFunc := source.st.GetIterator(
 			prefix,
 			storage.NewDefaultListOptions(false, cursor, limit),
 		)
@@ -186,12 +370,20 @@ end:
 			}
 
 			item = i.Clone()
-			if err := saveItemToOutput(dumpCmd, prefix, item); err != nil {
+			if keyFilter != nil && keyFilter.Done(prefix, item, savedCount) {
+				closeFunc()
+
+				break end
+			}
+
+			if saved, err := saveDumpedItem(prefix, item); err != nil {
 				log.Error("failed to save item", "error", err, "prefix", prefix, "cursor", cursor)
 
 				closeFunc()
 
-				return
+				return err
+			} else if saved {
+				savedCount += 1
 			}
 			allCount += 1
 			count += 1
@@ -203,6 +395,10 @@ end:
 			log.Debug("got items", "count", allCount, "prefix", allPrefixesWithName[prefix])
 		}
 
+		if count > 0 {
+			checkpoint.SetCursor(prefix, item.Key)
+		}
+
 		if count < int(limit) {
 			break end
 		}
@@ -210,10 +406,49 @@ end:
 		cursor = item.Key
 	}
 
-	log.Debug("dump from source finished", "item-count", allCount, "prefix", allPrefixesWithName[prefix])
+	addDumpedCount(prefix, savedCount)
+
+	log.Debug("dump from source finished", "item-count", allCount, "saved-count", savedCount, "prefix", allPrefixesWithName[prefix])
+
+	return nil
+}
+
+// getIteratorJsonRPC requests `DB.GetIterator`; the failed request is retried
+// `--retry` times with backoff. When the snapshot is not found, it is not
+// retried.
+func getIteratorJsonRPC(args runner.DBGetIteratorArgs) (result runner.DBGetIteratorResult, err error) {
+	backoff := retryBackoff
+	for i := 0; ; i++ {
+		if source.SnapshotExpired() {
+			return result, errSnapshotExpired
+		}
+
+		if result, err = source.getIteratorResult(args); err == nil {
+			return
+		} else if isSnapshotNotFound(err) {
+			source.setSnapshotExpired()
+			return result, errSnapshotExpired
+		} else if i >= flagRetry {
+			return
+		}
+
+		log.Warn(
+			"failed to DB.GetIterator; retry",
+			"error", err,
+			"prefix", allPrefixesWithName[args.Prefix],
+			"cursor", keyString(args.Options.Cursor),
+			"retry", i+1,
+			"backoff", backoff,
+		)
+		time.Sleep(backoff)
+
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
 }
 
-func dumpJsonRPC(prefix string) {
+func dumpJsonRPC(prefix string) error {
 	prefix_name := allPrefixesWithName[prefix]
 	log.Debug(
 		"DB.GetIterator",
@@ -221,11 +456,11 @@ func dumpJsonRPC(prefix string) {
 		"limit", runner.MaxLimitListOptions,
 	)
 
-	var count int
-	var cursor []byte
+	var count, savedCount int
+	cursor := dumpCursor(prefix)
 	for {
 		args := runner.DBGetIteratorArgs{
-			Snapshot: jsonrpcSnapshot,
+			Snapshot: source.snapshot,
 			Prefix:   prefix,
 			Options: runner.GetIteratorOptions{
 				Reverse: false,
@@ -233,17 +468,10 @@ func dumpJsonRPC(prefix string) {
 				Cursor:  cursor,
 			},
 		}
-		resp, err := request("DB.GetIterator", &args)
+		result, err := getIteratorJsonRPC(args)
 		if err != nil {
-			log.Error("failed to DB.GetIterator", "error", err, "prefix", prefix_name)
-			return
-		}
-		defer resp.Body.Close()
-
-		var result runner.DBGetIteratorResult
-		if err := jsonrpc.DecodeClientResponse(resp.Body, &result); err != nil {
-			log.Error("failed to parse result", "error", err, "prefix", prefix_name)
-			return
+			log.Error("failed to DB.GetIterator", "error", err, "prefix", prefix_name, "cursor", keyString(cursor))
+			return err
 		}
 
 		count += len(result.Items)
@@ -252,111 +480,172 @@ func dumpJsonRPC(prefix string) {
 			log.Debug("put items", "count", count, "prefix", prefix_name)
 		}
 
+		var done bool
 		for _, item := range result.Items {
-			if err := saveItemToOutput(dumpCmd, prefix, item); err != nil {
+			if keyFilter != nil && keyFilter.Done(prefix, item, savedCount) {
+				done = true
+				break
+			}
+
+			if saved, err := saveDumpedItem(prefix, item); err != nil {
 				log.Error("failed to save item", "error", err, "prefix", prefix_name)
-				return
+				return err
+			} else if saved {
+				savedCount += 1
 			}
 		}
 
-		if len(result.Items) < int(result.Limit) {
+		if len(result.Items) > 0 {
+			checkpoint.SetCursor(prefix, result.Items[len(result.Items)-1].Key)
+		}
+
+		if done || len(result.Items) < int(result.Limit) {
 			break
 		}
 		cursor = result.Items[len(result.Items)-1].Key
 	}
 
-	log.Debug("DB.GetIterator finished", "item-count", count, "prefix", prefix_name)
+	addDumpedCount(prefix, savedCount)
+
+	log.Debug("DB.GetIterator finished", "item-count", count, "saved-count", savedCount, "prefix", prefix_name)
+
+	return nil
 }
 
-func dump() {
-	var stSourceOrig *storage.LevelDBBackend
+// dump returns false when any prefix is not dumped completely.
+func dump() bool {
 	defer func() {
-		if stSourceOrig != nil {
-			stSource.Core.(*storage.Snapshot).Release()
-			stSource = stSourceOrig
-		}
-
-		if stSource != nil {
-			stSource.Close()
-		}
-		if stOutput != nil {
-			stOutput.Close()
+		if source != nil {
+			source.Close()
 		}
 
-		if jsonFiles != nil {
-			jsonFiles.Range(func(k, v interface{}) bool {
-				v.(*GzipWriter).Close()
-				return true
-			})
-		}
+		closeOutput()
 	}()
 
-	if stSource != nil {
-		stSourceOrig = stSource
-		if st, err := stSource.OpenSnapshot(); err != nil {
-			log.Error("failed to OpenSnapshot", "error", err)
-			return
+	// the prefixes are dumped at once, so the local storage also must be read
+	// from the snapshot not to be changed by the running node.
+	if err := source.OpenSnapshot(); err != nil {
+		log.Error("failed to OpenSnapshot", "error", err)
+		return false
+	}
+
+	latestBlock, err := source.LatestBlock()
+	if err != nil {
+		log.Error("failed to get latest block", "error", err)
+		return false
+	}
+	latestHeight := latestBlock.Height
+
+	if flagSinceHeight > 0 {
+		if hf, err := NewHeightFilter(flagSinceHeight); err != nil {
+			log.Error("failed to load blocks after height", "error", err, "height", flagSinceHeight)
+			return false
 		} else {
-			stSource = st
+			heightFilter = hf
 		}
 	}
 
-	if jsonRPCEndpoint != nil {
-		{ // OpenSnapshot
-			resp, err := request("DB.OpenSnapshot", &runner.DBOpenSnapshotResult{})
-			if err != nil {
-				log.Error("failed to OpenSnapshot", "error", err)
-				return
-			}
-			defer resp.Body.Close()
+	if source.IsJSONRPC() {
+		stopKeepAlive := source.KeepAlive(flagSnapshotKeepAlive)
+		defer stopKeepAlive()
+	}
 
-			var result runner.DBOpenSnapshotResult
-			if err := jsonrpc.DecodeClientResponse(resp.Body, &result); err != nil {
-				log.Error("failed to OpenSnapshot", "error", err)
-				return
-			}
+	// every s3 upload buffers it's parts in memory, so with s3 output, only
+	// `--workers` prefixes are dumped at once and the file of prefix is closed
+	// when the prefix is finished.
+	workers := len(flagPrefix)
+	if isS3Output(flagOutput) && flagWorkers < workers {
+		workers = flagWorkers
+	}
+	sem := make(chan struct{}, workers)
 
-			jsonrpcSnapshot = result.Snapshot
-			log.Debug("snapshot opened", "result", result)
-		}
+	var wg sync.WaitGroup
+	var failed sync.Map
+	wg.Add(len(flagPrefix))
+	for _, prefix := range flagPrefix {
+		p := allPrefixesByName[prefix]
+		go func() {
+			defer wg.Done()
 
-		defer func() { // ReleaseSnapshot
-			if len(jsonrpcSnapshot) < 1 {
-				return
-			}
-			resp, err := request("DB.ReleaseSnapshot", &runner.DBReleaseSnapshot{Snapshot: jsonrpcSnapshot})
-			if err != nil {
-				log.Error("failed to ReleaseSnapshot", "error", err)
-				return
+			sem <- struct{}{}
+			defer func() {
+				<-sem
+			}()
+
+			var err error
+			if source.IsJSONRPC() {
+				err = dumpJsonRPC(p)
+			} else {
+				err = dumpSource(p)
 			}
-			defer resp.Body.Close()
 
-			var result runner.DBReleaseSnapshotResult
-			if err := jsonrpc.DecodeClientResponse(resp.Body, &result); err != nil {
-				log.Error("failed to ReleaseSnapshot", "error", err)
-				return
+			if c, ok := outputSink.(PrefixCloser); ok {
+				if e := c.ClosePrefix(p); e != nil && err == nil {
+					err = e
+				}
 			}
-			log.Debug("snapshot released", "result", result)
 
-			return
+			if err != nil {
+				failed.Store(allPrefixesWithName[p], err)
+			}
 		}()
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(len(flagPrefix))
-	for _, prefix := range flagPrefix {
-		p := allPrefixesByName[prefix]
-		if jsonRPCEndpoint != nil {
-			go func() {
-				dumpJsonRPC(p)
-				wg.Done()
-			}()
-		} else if stSource != nil {
-			dumpSource(p)
+	wg.Wait()
+
+	closeOutput()
+
+	var failedPrefixes []string
+	failed.Range(func(k, v interface{}) bool {
+		failedPrefixes = append(failedPrefixes, k.(string))
+		return true
+	})
+
+	if len(failedPrefixes) > 0 {
+		sort.Strings(failedPrefixes)
+		log.Error("some prefixes are not dumped completely", "prefixes", failedPrefixes)
+
+		// the cursors are kept, so the next `--incremental` continues from
+		// them; the height is not changed and the other prefixes including the
+		// height prefixes are dumped again.
+		checkpoint.Failed = true
+		if fileStore != nil {
+			if err := checkpoint.Save(fileStore); err != nil {
+				log.Error("failed to save checkpoint", "error", err)
+			}
 		}
+
+		return false
 	}
 
-	wg.Wait()
+	if fileStore == nil {
+		log.Debug("finished; streamed to stdout", "height", latestBlock.Height, "block", latestBlock.Hash)
+
+		return true
+	}
+
+	checkpoint.Height = latestHeight
+	checkpoint.Failed = false
+	if err := checkpoint.Save(fileStore); err != nil {
+		log.Error("failed to save checkpoint", "error", err)
+		return false
+	}
+	log.Debug("checkpoint saved", "height", latestHeight)
+
+	manifest.Source = flagSource
+	manifest.NetworkID = flagNetworkID
+	manifest.Height = latestBlock.Height
+	manifest.BlockHash = latestBlock.Hash
+	manifest.Snapshot = source.SnapshotID()
+	manifest.Format = flagOutputFormat
+	manifest.Address = flagAddress
+	if err := manifest.Save(fileStore); err != nil {
+		log.Error("failed to save manifest", "error", err)
+		return false
+	}
+	log.Debug("manifest saved", "files", len(manifest.Files))
 
 	log.Debug("finished")
+
+	return true
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	"boscoin.io/sebak/lib/storage"
+)
+
+// addressPrefixNames are the name prefixes of the prefixes, which are dumped
+// with `--address`.
+var addressPrefixNames []string = []string{
+	"block-operation-",
+	"block-transaction-account",
+	"block-account-",
+}
+
+// KeyFilter limits the dumped items by the key range, the number of items of
+// each prefix and the address. The keys of range do not include the prefix.
+// With the address, the index items, which have only the hash of the selected
+// records like `block-operation-blockheight`, are not dumped, so the dump can
+// not be imported.
+type KeyFilter struct {
+	startKey []byte
+	endKey   []byte
+	limit    uint64
+	address  []byte
+}
+
+func NewKeyFilter(startKey, endKey string, limit uint64, address string) *KeyFilter {
+	return &KeyFilter{
+		startKey: []byte(startKey),
+		endKey:   []byte(endKey),
+		limit:    limit,
+		address:  []byte(address),
+	}
+}
+
+// Filter returns true when the item is in the key range and touches the
+// address; the address is searched in both key and value, the index prefixes
+// have the address in key and the records have it in value.
+func (k *KeyFilter) Filter(prefix string, item storage.IterItem) bool {
+	key := item.Key[len(prefix):]
+	if len(k.startKey) > 0 && bytes.Compare(key, k.startKey) < 0 {
+		return false
+	}
+
+	if len(k.address) < 1 {
+		return true
+	}
+
+	return bytes.Contains(key, k.address) || bytes.Contains(item.Value, k.address)
+}
+
+// Cursor returns the cursor to start the iteration of prefix from the start
+// key, so the items before the start key are not iterated. The cursor is just
+// before the start key, the start key is included whether the iterator includes
+// the item of cursor or not; the items between them are filtered by Filter.
+func (k *KeyFilter) Cursor(prefix string) []byte {
+	if len(k.startKey) < 1 {
+		return nil
+	}
+
+	cursor := append([]byte(prefix), k.startKey...)
+	if last := cursor[len(cursor)-1]; last > 0 {
+		cursor[len(cursor)-1] = last - 1
+	} else {
+		cursor = cursor[:len(cursor)-1]
+	}
+
+	return cursor
+}
+
+// Done returns true when the item is after the end key or the number of saved
+// items reaches the limit; the items after it do not need to be dumped.
+func (k *KeyFilter) Done(prefix string, item storage.IterItem, saved int) bool {
+	if k.limit > 0 && uint64(saved) >= k.limit {
+		return true
+	}
+
+	if len(k.endKey) > 0 && bytes.Compare(item.Key[len(prefix):], k.endKey) >= 0 {
+		return true
+	}
+
+	return false
+}
+
+// isAddressPrefix checks whether the prefix can have the items, which are
+// related with address.
+func isAddressPrefix(name string) bool {
+	for _, p := range addressPrefixNames {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stellar/go/keypair"
+
+	cmdcommon "boscoin.io/sebak/cmd/sebak/common"
+	"boscoin.io/sebak/lib/ballot"
+	"boscoin.io/sebak/lib/block"
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/storage"
+	"boscoin.io/sebak/lib/transaction"
+	"boscoin.io/sebak/lib/transaction/operation"
+	"boscoin.io/sebak/lib/voting"
+)
+
+const (
+	// generateBalance is the balance of genesis account; 5,000,000,000 BOS
+	generateBalance common.Amount = 50000000000000000
+	// generateFrozenUnit is the amount of frozen account; 10,000 BOS
+	generateFrozenUnit common.Amount = 100000000000
+	// generateBlockInterval is the interval of the proposed time of blocks
+	generateBlockInterval time.Duration = time.Second * 5
+)
+
+// generateStartTime is the proposed time of genesis block; the times are fixed
+// by height, so the same seed makes the same ledger.
+var generateStartTime time.Time = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var generateOperationTypes []string = []string{
+	"payment",
+	"create-account",
+	"freezing",
+	"unfreezing",
+}
+
+// GenerateAccount is the generated account with it's keypair.
+type GenerateAccount struct {
+	kp      *keypair.Full
+	account *block.BlockAccount
+	// frozen is set for the frozen account; the frozen account only requests
+	// to unfreeze.
+	frozen bool
+	// linked is the account, which freezes this account; the frozen balance
+	// is paid back to it.
+	linked *GenerateAccount
+	// unfreezing is the block height of the unfreezing request; after the
+	// request, the account is only used for the payout.
+	unfreezing uint64
+	// unfrozen is set after the payout; the account is not used any more.
+	unfrozen bool
+}
+
+// Generator makes the blocks, transactions and operations with the random
+// accounts; the random is seeded, so the ledger can be reproduced. The
+// proposer transaction of block collects the fees and the inflation to the
+// common account.
+type Generator struct {
+	st            *storage.LevelDBBackend
+	r             *rand.Rand
+	networkID     []byte
+	proposer      *keypair.Full
+	mix           map[string]int
+	accounts      []*GenerateAccount
+	commonAccount *GenerateAccount
+	changed       map[string]*GenerateAccount
+	// created are the accounts created in the next block
+	created []*GenerateAccount
+	latest  *block.Block
+}
+
+func parseFlagsGenerate(args []string) {
+	parseLogging(generateCmd)
+
+	if flagGenerateBlocks < 1 {
+		cmdcommon.PrintFlagsError(generateCmd, "--blocks", fmt.Errorf("must be greater than 0"))
+	}
+	if flagGenerateAccounts < 2 {
+		cmdcommon.PrintFlagsError(generateCmd, "--accounts", fmt.Errorf("must be greater than 1"))
+	}
+	if flagGenerateTxs < 1 {
+		cmdcommon.PrintFlagsError(generateCmd, "--txs-per-block", fmt.Errorf("must be greater than 0"))
+	}
+	if flagGenerateOps < 1 {
+		cmdcommon.PrintFlagsError(generateCmd, "--ops-per-tx", fmt.Errorf("must be greater than 0"))
+	}
+	if flagUnfreezingPeriod < 1 {
+		cmdcommon.PrintFlagsError(generateCmd, "--unfreezing-period", fmt.Errorf("must be greater than 0"))
+	}
+	if len(flagNetworkID) < 1 {
+		cmdcommon.PrintFlagsError(generateCmd, "--network-id", fmt.Errorf("must be given"))
+	}
+
+	if _, err := parseOperationMix(flagGenerateMix); err != nil {
+		cmdcommon.PrintFlagsError(generateCmd, "--mix", err)
+	}
+
+	{ // checkout output
+		flagOutput = args[0]
+
+		if _, err := os.Stat(flagOutput); !os.IsNotExist(err) {
+			if !flagForce {
+				cmdcommon.PrintFlagsError(generateCmd, "<output directory>", fmt.Errorf("directory, `%s` already exists", flagOutput))
+			}
+			if err := os.RemoveAll(flagOutput); err != nil {
+				cmdcommon.PrintFlagsError(generateCmd, "<output directory>", err)
+			}
+			log.Debug("output directory found, but remote it by force", "directory", flagOutput)
+		}
+
+		if storageConfig, err := storage.NewConfigFromString("file://" + flagOutput); err != nil {
+			cmdcommon.PrintFlagsError(generateCmd, "<output directory>", err)
+		} else {
+			if st, err := storage.NewStorage(storageConfig); err != nil {
+				cmdcommon.PrintFlagsError(generateCmd, "<output directory>", err)
+			} else {
+				stOutput = st
+			}
+		}
+	}
+
+	parsedFlags := []interface{}{}
+	parsedFlags = append(parsedFlags, "\n\tlog-level", logLevel)
+	parsedFlags = append(parsedFlags, "\n\tlog-format", flagLogFormat)
+	parsedFlags = append(parsedFlags, "\n\tlog", flagLog)
+	parsedFlags = append(parsedFlags, "\n\tforce", flagForce)
+	parsedFlags = append(parsedFlags, "\n\toutput", flagOutput)
+	parsedFlags = append(parsedFlags, "\n\tnetwork-id", flagNetworkID)
+	parsedFlags = append(parsedFlags, "\n\tseed", flagGenerateSeed)
+	parsedFlags = append(parsedFlags, "\n\tblocks", flagGenerateBlocks)
+	parsedFlags = append(parsedFlags, "\n\taccounts", flagGenerateAccounts)
+	parsedFlags = append(parsedFlags, "\n\ttxs-per-block", flagGenerateTxs)
+	parsedFlags = append(parsedFlags, "\n\tops-per-tx", flagGenerateOps)
+	parsedFlags = append(parsedFlags, "\n\tmix", flagGenerateMix)
+	parsedFlags = append(parsedFlags, "\n\tunfreezing-period", flagUnfreezingPeriod)
+	parsedFlags = append(parsedFlags, "\n", "")
+
+	log.Debug("parsed flags:", parsedFlags...)
+}
+
+// parseOperationMix parses the weights of operation types,
+// `<type>:<weight>,...`.
+func parseOperationMix(s string) (map[string]int, error) {
+	mix := map[string]int{}
+
+	var total int
+	for _, w := range strings.Split(s, ",") {
+		l := strings.SplitN(strings.TrimSpace(w), ":", 2)
+		if len(l) != 2 {
+			return nil, fmt.Errorf("invalid weight: %q", w)
+		}
+
+		var found bool
+		for _, t := range generateOperationTypes {
+			if t == l[0] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown operation type: %q", l[0])
+		}
+
+		weight, err := strconv.Atoi(l[1])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight: %q", w)
+		}
+		mix[l[0]] = weight
+		total += weight
+	}
+
+	if total < 1 {
+		return nil, fmt.Errorf("sum of weights must be greater than 0")
+	}
+
+	return mix, nil
+}
+
+func NewGenerator(st *storage.LevelDBBackend, seed int64, networkID []byte, mix map[string]int) (*Generator, error) {
+	g := &Generator{
+		st:        st,
+		r:         rand.New(rand.NewSource(seed)),
+		networkID: networkID,
+		mix:       mix,
+		changed:   map[string]*GenerateAccount{},
+	}
+
+	proposer, err := g.keypair()
+	if err != nil {
+		return nil, err
+	}
+	g.proposer = proposer
+
+	return g, nil
+}
+
+// keypair makes the keypair from the seeded random.
+func (g *Generator) keypair() (*keypair.Full, error) {
+	var seed [32]byte
+	g.r.Read(seed[:])
+
+	return keypair.FromRawSeed(seed)
+}
+
+func (g *Generator) proposedTime(height uint64) string {
+	t := generateStartTime.Add(generateBlockInterval * time.Duration(height-common.GenesisBlockHeight))
+	return t.Format(common.TIMEFORMAT_ISO8601)
+}
+
+// genesis saves the genesis block with the genesis and common account.
+func (g *Generator) genesis() error {
+	kp, err := g.keypair()
+	if err != nil {
+		return err
+	}
+	genesis := &GenerateAccount{kp: kp}
+	genesis.account = block.NewBlockAccount(genesis.kp.Address(), generateBalance)
+	if err := genesis.account.Save(g.st); err != nil {
+		return err
+	}
+
+	if kp, err = g.keypair(); err != nil {
+		return err
+	}
+	g.commonAccount = &GenerateAccount{kp: kp}
+	g.commonAccount.account = block.NewBlockAccount(kp.Address(), 0)
+	if err := g.commonAccount.account.Save(g.st); err != nil {
+		return err
+	}
+
+	if _, err := block.MakeGenesisBlock(g.st, *genesis.account, *g.commonAccount.account, g.networkID); err != nil {
+		return err
+	}
+
+	latest := block.GetLatestBlock(g.st)
+	g.latest = &latest
+	g.accounts = append(g.accounts, genesis)
+
+	return nil
+}
+
+// operationType selects the operation type by the weights of `--mix`.
+func (g *Generator) operationType() string {
+	var total int
+	for _, t := range generateOperationTypes {
+		total += g.mix[t]
+	}
+
+	n := g.r.Intn(total)
+	for _, t := range generateOperationTypes {
+		if n < g.mix[t] {
+			return t
+		}
+		n -= g.mix[t]
+	}
+
+	return "payment"
+}
+
+// operation makes the operation of source; the balances are updated. If the
+// operation can not be made, it returns false.
+func (g *Generator) operation(source *GenerateAccount, fee common.Amount, height uint64) (op operation.Operation, ok bool, err error) {
+	switch t := g.operationType(); t {
+	case "create-account", "freezing":
+		return g.createAccount(source, fee, t == "freezing")
+	case "unfreezing":
+		if !source.frozen || source.unfreezing > 0 {
+			return
+		}
+
+		if op, err = operation.NewOperation(operation.NewUnfreezeRequest()); err != nil {
+			return
+		}
+		source.unfreezing = height
+
+		return op, true, nil
+	}
+
+	return g.payment(source, fee)
+}
+
+// createAccount makes the create-account operation; with freezing, the created
+// account is frozen and linked to source.
+func (g *Generator) createAccount(source *GenerateAccount, fee common.Amount, freezing bool) (op operation.Operation, ok bool, err error) {
+	if source.frozen || len(g.accounts)+len(g.created) >= flagGenerateAccounts {
+		return
+	}
+
+	var amount common.Amount
+	var linked string
+	if freezing {
+		amount = generateFrozenUnit
+		linked = source.kp.Address()
+	} else {
+		amount = common.BaseReserve * common.Amount(1+g.r.Intn(1000))
+	}
+	if source.account.Balance < amount+fee+common.BaseReserve {
+		return
+	}
+
+	var kp *keypair.Full
+	if kp, err = g.keypair(); err != nil {
+		return
+	}
+
+	created := &GenerateAccount{kp: kp, frozen: freezing}
+	if freezing {
+		created.linked = source
+	}
+	created.account = block.NewBlockAccountLinked(kp.Address(), amount, linked)
+	if op, err = operation.NewOperation(operation.NewCreateAccount(kp.Address(), amount, linked)); err != nil {
+		return
+	}
+	source.account.Balance -= amount
+	g.changed[kp.Address()] = created
+	g.created = append(g.created, created)
+
+	return op, true, nil
+}
+
+// payment makes the payment operation to the random target.
+func (g *Generator) payment(source *GenerateAccount, fee common.Amount) (op operation.Operation, ok bool, err error) {
+	if len(g.accounts) < 2 {
+		return
+	}
+
+	target := g.accounts[g.r.Intn(len(g.accounts))]
+	if target == source || source.frozen || target.frozen {
+		return
+	}
+
+	amount := common.Amount(1 + g.r.Int63n(int64(common.BaseReserve)*10))
+	if source.account.Balance < amount+fee+common.BaseReserve {
+		return
+	}
+
+	if op, err = operation.NewOperation(operation.NewPayment(target.kp.Address(), amount)); err != nil {
+		return
+	}
+	source.account.Balance -= amount
+	target.account.Balance += amount
+	g.changed[target.kp.Address()] = target
+
+	return op, true, nil
+}
+
+// sign signs the transaction of source and updates the sequence id and the
+// balance of source.
+func (g *Generator) sign(source *GenerateAccount, height uint64, tx *transaction.Transaction, used map[string]bool) {
+	tx.H.Created = g.proposedTime(height)
+	tx.Sign(source.kp, g.networkID)
+
+	source.account.Balance -= tx.B.Fee
+	source.account.SequenceID += 1
+	used[source.kp.Address()] = true
+	g.changed[source.kp.Address()] = source
+}
+
+// transaction makes the signed transaction of the random source.
+func (g *Generator) transaction(height uint64, used map[string]bool) (tx transaction.Transaction, ok bool, err error) {
+	source := g.accounts[g.r.Intn(len(g.accounts))]
+	if used[source.kp.Address()] || source.unfreezing > 0 {
+		return
+	}
+
+	var ops []operation.Operation
+	n := 1 + g.r.Intn(flagGenerateOps)
+	for i := 0; i < n; i++ {
+		op, opOK, err := g.operation(source, common.BaseFee*common.Amount(len(ops)+1), height)
+		if err != nil {
+			return tx, false, err
+		} else if !opOK {
+			continue
+		}
+		ops = append(ops, op)
+	}
+
+	if len(ops) < 1 {
+		return
+	}
+
+	if tx, err = transaction.NewTransaction(source.kp.Address(), source.account.SequenceID, ops...); err != nil {
+		return
+	}
+	g.sign(source, height, &tx, used)
+
+	return tx, true, nil
+}
+
+// saveChanged saves the changed accounts; like SEBAK, the accounts are saved
+// after each transaction, so the sequence id history has the balance after the
+// transaction. The accounts are saved in order, so the history is also
+// reproducible.
+func (g *Generator) saveChanged() error {
+	var addresses []string
+	for address := range g.changed {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		if err := g.changed[address].account.Save(g.st); err != nil {
+			return err
+		}
+	}
+	g.changed = map[string]*GenerateAccount{}
+
+	return nil
+}
+
+// payouts makes the payment transactions of the frozen accounts, which passed
+// `--unfreezing-period` after the unfreezing request; the whole balance except
+// the fee is paid to the linked account.
+func (g *Generator) payouts(height uint64, used map[string]bool) ([]transaction.Transaction, error) {
+	var txs []transaction.Transaction
+	for _, source := range g.accounts {
+		if source.unfreezing < 1 || source.unfrozen || height < source.unfreezing+flagUnfreezingPeriod {
+			continue
+		}
+
+		amount := source.account.Balance - common.BaseFee
+		op, err := operation.NewOperation(operation.NewPayment(source.linked.kp.Address(), amount))
+		if err != nil {
+			return nil, err
+		}
+
+		tx, err := transaction.NewTransaction(source.kp.Address(), source.account.SequenceID, op)
+		if err != nil {
+			return nil, err
+		}
+		g.sign(source, height, &tx, used)
+
+		source.unfrozen = true
+		source.linked.account.Balance += amount
+		g.changed[source.linked.kp.Address()] = source.linked
+		if err := g.saveChanged(); err != nil {
+			return nil, err
+		}
+
+		txs = append(txs, tx)
+	}
+
+	return txs, nil
+}
+
+// proposerTransaction makes the proposer transaction, which pays the fees of
+// the transactions and the inflation to the common account.
+func (g *Generator) proposerTransaction(height uint64, txs []transaction.Transaction) (ptx ballot.ProposerTransaction, err error) {
+	var fees common.Amount
+	for _, tx := range txs {
+		fees += tx.B.Fee
+	}
+
+	var inflation common.Amount
+	if inflation, err = common.CalculateInflation(generateBalance); err != nil {
+		return
+	}
+
+	target := g.commonAccount.kp.Address()
+	bodies := []operation.Body{
+		operation.NewCollectTxFee(
+			target,
+			fees,
+			uint64(len(txs)),
+			g.latest.Height,
+			g.latest.Hash,
+			g.latest.TotalTxs,
+			g.latest.TotalOps,
+		),
+		operation.NewInflation(
+			target,
+			inflation,
+			generateBalance,
+			common.InflationRatioString,
+			g.latest.Height,
+			g.latest.Hash,
+			g.latest.TotalTxs,
+			g.latest.TotalOps,
+		),
+	}
+
+	var ops []operation.Operation
+	for _, body := range bodies {
+		op, err := operation.NewOperation(body)
+		if err != nil {
+			return ptx, err
+		}
+		ops = append(ops, op)
+	}
+
+	if ptx, err = ballot.NewProposerTransaction(g.proposer.Address(), ops...); err != nil {
+		return
+	}
+	ptx.H.Created = g.proposedTime(height)
+	ptx.Sign(g.proposer, g.networkID)
+
+	g.commonAccount.account.Balance += fees + inflation
+	g.changed[target] = g.commonAccount
+	if err = g.saveChanged(); err != nil {
+		return
+	}
+
+	return ptx, nil
+}
+
+// next saves the next block with the random transactions.
+func (g *Generator) next() error {
+	height := g.latest.Height + 1
+	proposedTime := g.proposedTime(height)
+
+	used := map[string]bool{}
+	txs, err := g.payouts(height, used)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < flagGenerateTxs; i++ {
+		tx, ok, err := g.transaction(height, used)
+		if err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		if err := g.saveChanged(); err != nil {
+			return err
+		}
+
+		txs = append(txs, tx)
+	}
+	g.accounts = append(g.accounts, g.created...)
+	g.created = nil
+
+	var hashes []string
+	for _, tx := range txs {
+		hashes = append(hashes, tx.GetHash())
+	}
+
+	ptx, err := g.proposerTransaction(height, txs)
+	if err != nil {
+		return err
+	}
+
+	basis := voting.Basis{
+		Round:     0,
+		Height:    g.latest.Height,
+		BlockHash: g.latest.Hash,
+		TotalTxs:  g.latest.TotalTxs,
+		TotalOps:  g.latest.TotalOps,
+	}
+	blk := block.NewBlock(g.proposer.Address(), basis, ptx.GetHash(), hashes, proposedTime)
+	if err := blk.Save(g.st); err != nil {
+		return err
+	}
+
+	for _, tx := range append([]transaction.Transaction{ptx.Transaction}, txs...) {
+		if err := block.SaveTransactionPool(g.st, tx); err != nil {
+			return err
+		}
+
+		bt := block.NewBlockTransactionFromTransaction(blk.Hash, blk.Height, blk.ProposedTime, tx)
+		if err := bt.Save(g.st); err != nil {
+			return err
+		}
+
+		for i, op := range tx.B.Operations {
+			bo, err := block.NewBlockOperationFromOperation(op, tx, blk.Height, i)
+			if err != nil {
+				return err
+			}
+			if err := bo.Save(g.st); err != nil {
+				return err
+			}
+		}
+	}
+
+	g.latest = blk
+
+	return nil
+}
+
+func generate() bool {
+	defer stOutput.Close()
+
+	mix, _ := parseOperationMix(flagGenerateMix)
+	g, err := NewGenerator(stOutput, flagGenerateSeed, []byte(flagNetworkID), mix)
+	if err != nil {
+		log.Error("failed to make generator", "error", err)
+		return false
+	}
+
+	if err := g.genesis(); err != nil {
+		log.Error("failed to make genesis block", "error", err)
+		return false
+	}
+
+	for g.latest.Height < common.GenesisBlockHeight+flagGenerateBlocks-1 {
+		if err := g.next(); err != nil {
+			log.Error("failed to make block", "error", err, "height", g.latest.Height+1)
+			return false
+		}
+
+		if g.latest.Height%1000 == 0 {
+			log.Debug("blocks generated", "height", g.latest.Height, "accounts", len(g.accounts))
+		}
+	}
+
+	log.Info(
+		"generated",
+		"height", g.latest.Height,
+		"block", g.latest.Hash,
+		"transactions", g.latest.TotalTxs,
+		"operations", g.latest.TotalOps,
+		"accounts", len(g.accounts),
+	)
+
+	return true
+}
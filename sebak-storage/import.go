@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"compress/gzip"
 	"encoding/json"
 	"fmt"
@@ -10,11 +11,22 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
 
 	cmdcommon "boscoin.io/sebak/cmd/sebak/common"
+	"boscoin.io/sebak/lib/common"
 	"boscoin.io/sebak/lib/storage"
 )
 
+const importMarkerFileName string = "import-progress.json"
+
+// importFromLevelDB is set when the dump directory is the leveldb dump.
+var importFromLevelDB bool
+
 func parseFlagsImport(args []string) {
 	parseLogging(importCmd)
 
@@ -27,13 +39,38 @@ func parseFlagsImport(args []string) {
 		}
 	}
 
+	if flagBatchSize < 1 {
+		cmdcommon.PrintFlagsError(importCmd, "--batch-size", fmt.Errorf("should be over 0"))
+	}
+	if flagWorkers < 1 {
+		cmdcommon.PrintFlagsError(importCmd, "--workers", fmt.Errorf("should be over 0"))
+	}
+
+	switch flagConflict {
+	case "skip", "overwrite", "fail":
+	default:
+		cmdcommon.PrintFlagsError(importCmd, "--conflict", fmt.Errorf("unknown conflict policy found"))
+	}
+	if importCmd.Flags().Changed("conflict") && !flagMerge {
+		cmdcommon.PrintFlagsError(importCmd, "--conflict", fmt.Errorf("only with --merge"))
+	}
+	if flagMerge && flagForce {
+		cmdcommon.PrintFlagsError(importCmd, "--merge", fmt.Errorf("can not be used with --force"))
+	}
+
 	{ // check source
 		flagSource = args[0]
 
-		if _, err := os.Stat(flagSource); !os.IsNotExist(err) {
+		// leveldb dump has the `CURRENT` file of leveldb
+		if _, err := os.Stat(filepath.Join(flagSource, "CURRENT")); err == nil {
+			importFromLevelDB = true
+		}
+
+		// with '-', the jsonl stream is read from stdin
+		if _, err := os.Stat(flagSource); flagSource != streamPath && !os.IsNotExist(err) && !importFromLevelDB {
 			d, err := os.Open(flagSource)
 			if err != nil {
-				cmdcommon.PrintFlagsError(importCmd, "<json dump directory>", err)
+				cmdcommon.PrintFlagsError(importCmd, "<dump directory>", err)
 			}
 			defer d.Close()
 
@@ -44,7 +81,7 @@ func parseFlagsImport(args []string) {
 				} else {
 					log.Error("failed to read json dump directory", "error", err)
 				}
-				cmdcommon.PrintFlagsError(importCmd, "<json dump directory>", err)
+				cmdcommon.PrintFlagsError(importCmd, "<dump directory>", err)
 				return
 			} else {
 				for _, f := range files {
@@ -55,11 +92,44 @@ func parseFlagsImport(args []string) {
 				}
 			}
 			if !gzippedFound {
-				cmdcommon.PrintFlagsError(importCmd, "<json dump directory>", fmt.Errorf("gzipped json.gz not found", "<json dump directory>"))
+				cmdcommon.PrintFlagsError(importCmd, "<dump directory>", fmt.Errorf("gzipped json.gz not found"))
 			}
 		}
 	}
 
+	{ // check manifest
+		if flagSource == streamPath {
+			log.Debug("manifest is not checked for stdin")
+		} else if m, err := loadManifest(flagSource); os.IsNotExist(err) {
+			log.Warn("manifest not found", "directory", flagSource)
+		} else if err != nil {
+			cmdcommon.PrintFlagsError(importCmd, "<dump directory>", err)
+		} else if len(m.Address) > 0 {
+			// the index items, which have only the hash, are not dumped by
+			// `--address`, so the imported storage can not be used
+			cmdcommon.PrintFlagsError(importCmd, "<dump directory>", fmt.Errorf("dump of --address, %s can not be imported", m.Address))
+		} else if importFromLevelDB {
+			// the files of leveldb are changed whenever it is opened
+			log.Debug("manifest found, files of leveldb dump are not checked", "height", m.Height, "block", m.BlockHash, "network-id", m.NetworkID)
+		} else if err := m.Check(flagSource); err != nil {
+			if !flagIgnoreManifest {
+				cmdcommon.PrintFlagsError(importCmd, "<dump directory>", fmt.Errorf("manifest does not match: %v", err))
+			}
+			log.Warn("manifest does not match, but ignored", "error", err)
+		} else {
+			log.Debug("manifest matched", "height", m.Height, "block", m.BlockHash, "network-id", m.NetworkID)
+		}
+	}
+
+	if importFromLevelDB { // open leveldb dump
+		st, err := checkSourceDirectory(flagSource)
+		if err != nil {
+			cmdcommon.PrintFlagsError(importCmd, "<dump directory>", err)
+		}
+		stLocal = st
+		source = &Source{st: st}
+	}
+
 	{ // checkout output
 		flagOutput = args[1]
 
@@ -72,6 +142,8 @@ func parseFlagsImport(args []string) {
 
 			if _, err = d.Readdirnames(1); err == io.EOF {
 				// empty
+			} else if flagMerge {
+				log.Debug("output directory found, items will be merged", "directory", flagOutput, "conflict", flagConflict)
 			} else {
 				if flagForce {
 					if err := os.RemoveAll(flagOutput); err != nil {
@@ -79,6 +151,8 @@ func parseFlagsImport(args []string) {
 						cmdcommon.PrintFlagsError(importCmd, "<output directory>", err)
 					}
 					log.Debug("output directory found, but remote it by force", "directory", flagOutput)
+				} else if _, err := os.Stat(filepath.Join(flagOutput, importMarkerFileName)); err == nil {
+					log.Debug("unfinished import found, it will be resumed", "directory", flagOutput)
 				} else {
 					cmdcommon.PrintFlagsError(importCmd, "<output directory>", fmt.Errorf("directory, `%s` is not empty", flagOutput))
 				}
@@ -101,89 +175,527 @@ func parseFlagsImport(args []string) {
 	parsedFlags = append(parsedFlags, "\n\tlog-format", flagLogFormat)
 	parsedFlags = append(parsedFlags, "\n\tlog", flagLog)
 	parsedFlags = append(parsedFlags, "\n\tforce", flagForce)
-	parsedFlags = append(parsedFlags, "\n\tjson dump", flagSource)
+	parsedFlags = append(parsedFlags, "\n\tdump", flagSource)
+	parsedFlags = append(parsedFlags, "\n\tleveldb dump", importFromLevelDB)
 	parsedFlags = append(parsedFlags, "\n\toutput", flagOutput)
+	parsedFlags = append(parsedFlags, "\n\tmerge", flagMerge)
+	parsedFlags = append(parsedFlags, "\n\tconflict", flagConflict)
+	parsedFlags = append(parsedFlags, "\n\tignore-manifest", flagIgnoreManifest)
+	parsedFlags = append(parsedFlags, "\n\tbatch-size", flagBatchSize)
+	parsedFlags = append(parsedFlags, "\n\tworkers", flagWorkers)
 	parsedFlags = append(parsedFlags, "\n", "")
 
 	log.Debug("parsed flags:", parsedFlags...)
 }
 
-func importSourceFile(p string) {
+// ImportMarker keeps the number of imported lines by file; if import is
+// interrupted, the next import skips the imported lines. For the leveldb dump,
+// the progress is kept by prefix with the last imported key. The import can be
+// resumed only from the same dump directory.
+type ImportMarker struct {
+	sync.Mutex
+
+	Source  string                         `json:"source"`
+	Files   map[string]*ImportFileProgress `json:"files"`
+	Updated string                         `json:"updated"`
+}
+
+type ImportFileProgress struct {
+	Lines  uint64 `json:"lines"`
+	Cursor []byte `json:"cursor,omitempty"`
+	Done   bool   `json:"done"`
+}
+
+func loadImportMarker(directory, source string) (*ImportMarker, error) {
+	m := &ImportMarker{Source: source, Files: map[string]*ImportFileProgress{}}
+
+	b, err := ioutil.ReadFile(filepath.Join(directory, importMarkerFileName))
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	if m.Source != source {
+		return nil, fmt.Errorf("unfinished import from the other dump found: %q", m.Source)
+	}
+	if m.Files == nil {
+		m.Files = map[string]*ImportFileProgress{}
+	}
+
+	return m, nil
+}
+
+func (m *ImportMarker) Get(name string) ImportFileProgress {
+	m.Lock()
+	defer m.Unlock()
+
+	if p, found := m.Files[name]; found {
+		return *p
+	}
+
+	return ImportFileProgress{}
+}
+
+func (m *ImportMarker) Set(name string, p ImportFileProgress) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.Files[name] = &p
+	m.Updated = common.NowISO8601()
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	// the marker is replaced by rename not to be broken by crash
+	f := filepath.Join(flagOutput, importMarkerFileName)
+	if err := ioutil.WriteFile(f+".tmp", b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(f+".tmp", f)
+}
+
+func (m *ImportMarker) Remove() error {
+	return os.Remove(filepath.Join(flagOutput, importMarkerFileName))
+}
+
+// ImportProgress counts the read bytes of the gzipped files and the imported
+// items for throughput and ETA; for the leveldb dump, the total and read are
+// the number of prefixes.
+type ImportProgress struct {
+	total   int64
+	read    int64
+	items   int64
+	started time.Time
+
+	// unchanged and conflicts are counted with `--merge`
+	unchanged int64
+	conflicts int64
+}
+
+func (p *ImportProgress) Log() {
+	read := atomic.LoadInt64(&p.read)
+	items := atomic.LoadInt64(&p.items)
+	elapsed := time.Since(p.started)
+
+	var eta time.Duration
+	if read > 0 && p.total > read {
+		eta = time.Duration(float64(elapsed) * float64(p.total-read) / float64(read))
+	}
+
+	var rate int64
+	if elapsed > time.Second {
+		rate = int64(float64(items) / elapsed.Seconds())
+	}
+
+	// the total of stream is unknown
+	percent := "-"
+	if p.total > 0 {
+		percent = fmt.Sprintf("%.1f%%", float64(read)*100/float64(p.total))
+	}
+
+	log.Info(
+		"import progress",
+		"items", items,
+		"items/s", rate,
+		"read", percent,
+		"elapsed", elapsed.Truncate(time.Second),
+		"eta", eta.Truncate(time.Second),
+		"unchanged", atomic.LoadInt64(&p.unchanged),
+		"conflicts", atomic.LoadInt64(&p.conflicts),
+	)
+}
+
+// importPut puts the item into batch. With `--merge`, the existing item is
+// compared; the same item is skipped and the different item follows
+// `--conflict`.
+func importPut(batch *leveldb.Batch, item storage.IterItem, progress *ImportProgress) error {
+	if !flagMerge {
+		batch.Put(item.Key, item.Value)
+		return nil
+	}
+
+	b, err := stOutput.Core.Get(item.Key, nil)
+	if err == leveldb.ErrNotFound {
+		batch.Put(item.Key, item.Value)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if bytes.Equal(b, item.Value) {
+		atomic.AddInt64(&progress.unchanged, 1)
+		return nil
+	}
+
+	atomic.AddInt64(&progress.conflicts, 1)
+	switch flagConflict {
+	case "skip":
+		log.Debug("conflict found; skipped", "key", keyString(item.Key))
+	case "overwrite":
+		log.Debug("conflict found; overwritten", "key", keyString(item.Key))
+		batch.Put(item.Key, item.Value)
+	default:
+		return fmt.Errorf("conflict found: %s", keyString(item.Key))
+	}
+
+	return nil
+}
+
+// writeImportBatch writes the batch into the output.
+func writeImportBatch(batch *leveldb.Batch, progress *ImportProgress) error {
+	if batch.Len() < 1 {
+		return nil
+	}
+
+	if err := stOutput.Core.Write(batch, nil); err != nil {
+		return err
+	}
+	atomic.AddInt64(&progress.items, int64(batch.Len()))
+	batch.Reset()
+
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+func importSourceFile(p string, marker *ImportMarker, progress *ImportProgress) error {
+	name := filepath.Base(p)
+	fileProgress := marker.Get(name)
+
 	f, err := os.Open(p)
 	if err != nil {
-		cmdcommon.PrintFlagsError(
-			importCmd,
-			"<json dump directory>",
-			fmt.Errorf("failed to read file: %s: %v", p, err),
-		)
+		return fmt.Errorf("failed to read file: %s: %v", p, err)
 	}
 	defer f.Close()
 
-	fz, err := gzip.NewReader(f)
+	fz, err := gzip.NewReader(countingReader{r: f, n: &progress.read})
 	if err != nil {
-		f.Close()
+		return fmt.Errorf("failed to read gzipped file: %s: %v", p, err)
+	}
+	defer fz.Close()
+
+	write := func(batch *leveldb.Batch, lines uint64) error {
+		if err := writeImportBatch(batch, progress); err != nil {
+			return err
+		}
 
-		cmdcommon.PrintFlagsError(
-			importCmd,
-			"<json dump directory>",
-			fmt.Errorf("failed to read gzipped file: %s: %v", p, err),
-		)
+		return marker.Set(name, ImportFileProgress{Lines: lines})
 	}
-	fz.Close()
 
-	var count int
+	if fileProgress.Lines > 0 {
+		log.Debug("skip imported lines", "file", name, "lines", fileProgress.Lines)
+	}
+
+	var lines uint64
 	var item storage.IterItem
+	batch := new(leveldb.Batch)
 	r := bufio.NewReader(fz)
 	for {
-		var (
-			isPrefix bool = true
-			err      error
-			l, b     []byte
-		)
+		b, err := readLine(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read line: %s: %v", p, err)
+		}
 
-		for isPrefix && err == nil {
-			l, isPrefix, err = r.ReadLine()
-			b = append(b, l...)
+		lines += 1
+		if lines <= fileProgress.Lines {
+			continue
 		}
+
+		if err := json.Unmarshal(b, &item); err != nil {
+			return fmt.Errorf("failed to parse line: %s: `%s`: %v", p, string(b), err)
+		}
+
+		if err := importPut(batch, item, progress); err != nil {
+			return fmt.Errorf("failed to import line: %s: %v", p, err)
+		}
+		if batch.Len() >= flagBatchSize {
+			if err := write(batch, lines); err != nil {
+				return fmt.Errorf("failed to write batch: %s: %v", p, err)
+			}
+		}
+	}
+
+	if err := write(batch, lines); err != nil {
+		return fmt.Errorf("failed to write batch: %s: %v", p, err)
+	}
+
+	return marker.Set(name, ImportFileProgress{Lines: lines, Done: true})
+}
+
+// importStream imports the jsonl stream of `dump --format jsonl`; the stream
+// can not be resumed.
+func importStream(r io.Reader, progress *ImportProgress) error {
+	var lines uint64
+	batch := new(leveldb.Batch)
+	br := bufio.NewReader(countingReader{r: r, n: &progress.read})
+	for {
+		b, err := readLine(br)
 		if err == io.EOF {
 			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read line: %v", err)
 		}
+		lines += 1
 
+		var item StreamItem
 		if err := json.Unmarshal(b, &item); err != nil {
-			cmdcommon.PrintFlagsError(
-				importCmd,
-				"<json dump directory>",
-				fmt.Errorf("failed to parse line: %s: `%s`: %v", p, string(b), err),
-			)
+			return fmt.Errorf("failed to parse line: %d: `%s`: %v", lines, string(b), err)
+		}
+
+		if prefix, found := allPrefixesByName[item.Prefix]; !found || !bytes.HasPrefix(item.Key, []byte(prefix)) {
+			return fmt.Errorf("invalid prefix: %d: %q", lines, item.Prefix)
 		}
 
-		if err := saveItemToOutput(dumpCmd, "", item); err != nil {
-			cmdcommon.PrintFlagsError(
-				importCmd,
-				"<json dump directory>",
-				fmt.Errorf("failed to save item: %s: `%s`: %v", p, string(b), err),
-			)
+		if err := importPut(batch, item.IterItem, progress); err != nil {
+			return fmt.Errorf("failed to import line: %d: %v", lines, err)
 		}
-		if count > 0 && count%100000 == 0 {
-			log.Debug("items loaded", "file", filepath.Base(p), "count", count)
+		if batch.Len() >= flagBatchSize {
+			if err := writeImportBatch(batch, progress); err != nil {
+				return fmt.Errorf("failed to write batch: %v", err)
+			}
 		}
-		count += 1
 	}
+
+	if err := writeImportBatch(batch, progress); err != nil {
+		return fmt.Errorf("failed to write batch: %v", err)
+	}
+
+	return nil
 }
 
-func importSource() {
+// readLine reads the whole line, even if it is longer than the buffer.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	var (
+		isPrefix bool = true
+		err      error
+		l, b     []byte
+	)
+
+	for isPrefix && err == nil {
+		l, isPrefix, err = r.ReadLine()
+		b = append(b, l...)
+	}
+
+	return b, err
+}
+
+// importSourcePrefix imports the items of prefix from the leveldb dump.
+func importSourcePrefix(prefix string, marker *ImportMarker, progress *ImportProgress) error {
+	name := allPrefixesWithName[prefix]
+	fileProgress := marker.Get(name)
+	if fileProgress.Cursor != nil {
+		log.Debug("skip imported items", "prefix", name, "items", fileProgress.Lines)
+	}
+
+	lines := fileProgress.Lines
+	cursor := fileProgress.Cursor
+	batch := new(leveldb.Batch)
+	write := func() error {
+		if err := writeImportBatch(batch, progress); err != nil {
+			return err
+		}
+
+		return marker.Set(name, ImportFileProgress{Lines: lines, Cursor: cursor})
+	}
+
+	err := source.Walk(prefix, fileProgress.Cursor, func(item storage.IterItem) (bool, error) {
+		if err := importPut(batch, item, progress); err != nil {
+			return false, err
+		}
+		lines += 1
+		cursor = item.Key
+
+		if batch.Len() < flagBatchSize {
+			return true, nil
+		}
+
+		return true, write()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import prefix: %s: %v", name, err)
+	}
+
+	if err := write(); err != nil {
+		return fmt.Errorf("failed to write batch: %s: %v", name, err)
+	}
+	atomic.AddInt64(&progress.read, 1)
+
+	return marker.Set(name, ImportFileProgress{Lines: lines, Cursor: cursor, Done: true})
+}
+
+// importPaths returns the gzipped json files to be imported.
+func importPaths(marker *ImportMarker, progress *ImportProgress) ([]string, error) {
 	files, err := ioutil.ReadDir(flagSource)
 	if err != nil {
-		cmdcommon.PrintFlagsError(importCmd, "<json dump directory>", err)
+		return nil, err
 	}
 
+	var paths []string
 	for _, f := range files {
-		log.Debug("trying to load", "file", f.Name())
-		importSourceFile(filepath.Join(flagSource, f.Name()))
-		log.Debug("loaded", "file", f.Name())
+		if !strings.HasSuffix(f.Name(), ".json.gz") {
+			continue
+		} else if strings.HasSuffix(f.Name(), ".decoded.json.gz") {
+			log.Warn("decoded json can not be imported; skipped", "file", f.Name())
+			continue
+		}
+
+		progress.total += f.Size()
+		if marker.Get(f.Name()).Done {
+			log.Debug("already imported", "file", f.Name())
+			progress.read += f.Size()
+			continue
+		}
+
+		paths = append(paths, filepath.Join(flagSource, f.Name()))
+	}
+
+	return paths, nil
+}
+
+// importPrefixes returns the prefixes of leveldb dump to be imported.
+func importPrefixes(marker *ImportMarker, progress *ImportProgress) []string {
+	var prefixes []string
+	for _, prefix := range allPrefixes {
+		progress.total += 1
+		if marker.Get(allPrefixesWithName[prefix]).Done {
+			log.Debug("already imported", "prefix", allPrefixesWithName[prefix])
+			progress.read += 1
+			continue
+		}
+
+		prefixes = append(prefixes, prefix)
+	}
+
+	return prefixes
+}
+
+func importSource() {
+	defer stOutput.Close()
+	if source != nil {
+		defer source.Close()
 	}
 
-	stOutput.Close()
+	markerSource := flagSource
+	if flagSource != streamPath {
+		if p, err := filepath.Abs(flagSource); err == nil {
+			markerSource = p
+		}
+	}
+
+	marker, err := loadImportMarker(flagOutput, markerSource)
+	if err != nil {
+		cmdcommon.PrintFlagsError(importCmd, "<output directory>", err)
+	}
+
+	progress := &ImportProgress{started: time.Now()}
+
+	// paths are the gzipped json files or the prefixes of leveldb dump
+	var paths []string
+	if flagSource == streamPath {
+		// stdin is not resumed
+	} else if importFromLevelDB {
+		paths = importPrefixes(marker, progress)
+	} else if paths, err = importPaths(marker, progress); err != nil {
+		cmdcommon.PrintFlagsError(importCmd, "<dump directory>", err)
+	}
+
+	stopProgress := make(chan bool)
+	go func() {
+		ticker := time.NewTicker(time.Second * 10)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				progress.Log()
+			case <-stopProgress:
+				return
+			}
+		}
+	}()
+
+	if flagSource == streamPath {
+		err := importStream(os.Stdin, progress)
+		close(stopProgress)
+		progress.Log()
+
+		if err != nil {
+			log.Error("import failed; stream can not be resumed", "error", err)
+			stOutput.Close()
+			os.Exit(1)
+		}
+
+		log.Debug("finished")
+		return
+	}
+
+	var failed int32
+	var wg sync.WaitGroup
+	chanPaths := make(chan string)
+	for i := 0; i < flagWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for p := range chanPaths {
+				if importFromLevelDB {
+					log.Debug("trying to load", "prefix", allPrefixesWithName[p])
+					if err := importSourcePrefix(p, marker, progress); err != nil {
+						log.Error("failed to import", "prefix", allPrefixesWithName[p], "error", err)
+						atomic.StoreInt32(&failed, 1)
+						continue
+					}
+					log.Debug("loaded", "prefix", allPrefixesWithName[p])
+					continue
+				}
+
+				log.Debug("trying to load", "file", filepath.Base(p))
+				if err := importSourceFile(p, marker, progress); err != nil {
+					log.Error("failed to import", "file", filepath.Base(p), "error", err)
+					atomic.StoreInt32(&failed, 1)
+					continue
+				}
+				log.Debug("loaded", "file", filepath.Base(p))
+			}
+		}()
+	}
+
+	for _, p := range paths {
+		chanPaths <- p
+	}
+	close(chanPaths)
+
+	wg.Wait()
+	close(stopProgress)
+	progress.Log()
+
+	if atomic.LoadInt32(&failed) > 0 {
+		log.Error("import failed; run again to resume", "directory", flagOutput)
+		stOutput.Close()
+		os.Exit(1)
+	}
+
+	if err := marker.Remove(); err != nil && !os.IsNotExist(err) {
+		log.Error("failed to remove import marker", "error", err)
+	}
 
 	log.Debug("finished")
 }
@@ -5,8 +5,8 @@ import (
 	"flag"
 	"os"
 	"strings"
-	"sync"
 	"text/template"
+	"time"
 
 	logging "github.com/inconshreveable/log15"
 	isatty "github.com/mattn/go-isatty"
@@ -26,23 +26,68 @@ var (
 	flagLogFormat    string      = common.GetENVValue("SEBAK_LOG_FORMAT", defaultLogFormat)
 	flagForce        bool
 
-	flagSource       string
-	flagOutput       string
-	flagPrefix       ListFlags
-	flagListPrefix   bool
-	flagOutputFormat string = "leveldb" // "json"
+	flagSource            string
+	flagOutput            string
+	flagPrefix            ListFlags
+	flagListPrefix        bool
+	flagOutputFormat      string = "leveldb" // "json", "json-decoded", "sqlite", "jsonl"
+	flagIncremental       bool
+	flagSinceHeight       uint64
+	flagDiffFormat        string = "summary" // "jsonl"
+	flagBatchSize         int    = 10000
+	flagWorkers           int    = 4
+	flagNetworkID         string
+	flagIgnoreManifest    bool
+	flagStartKey          string
+	flagEndKey            string
+	flagLimit             uint64
+	flagAddress           string
+	flagTop               int    = 5
+	flagS3Region          string = "ap-northeast-2"
+	flagS3Endpoint        string
+	flagRetry             int = 5
+	flagHeight            uint64
+	flagDryRun            bool
+	flagScanLimit         uint64 = 20
+	flagReverse           bool
+	flagAnonymize         bool
+	flagStripMemo         bool
+	flagStripSignature    bool
+	flagSnapshotKeepAlive time.Duration = time.Second * 30
+	flagMerge             bool
+	flagConflict          string = "fail" // "skip", "overwrite"
+	flagGenerateSeed      int64  = 1
+	flagGenerateBlocks    uint64 = 100
+	flagGenerateAccounts  int    = 100
+	flagGenerateTxs       int    = 10
+	flagGenerateOps       int    = 3
+	flagGenerateMix       string = "payment:70,create-account:20,freezing:5,unfreezing:5"
+	flagUnfreezingPeriod  uint64 = common.UnfreezingPeriod
 
 	flags    *flag.FlagSet = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	logLevel logging.Lvl
 	log      logging.Logger = logging.New("module", "main")
+	// logStream is stderr when the dump is streamed to stdout
+	logStream *os.File = os.Stdout
 
-	jsonRPCEndpoint *common.Endpoint
-	jsonrpcSnapshot string
-	stSource        *storage.LevelDBBackend
-	stOutput        *storage.LevelDBBackend
-	jsonFiles       *sync.Map
+	source       *Source
+	sourceB      *Source
+	stOutput     *storage.LevelDBBackend
+	stLocal      *storage.LevelDBBackend
+	outputSink   OutputSink
+	fileStore    FileStore
+	checkpoint   *Checkpoint
+	heightFilter *HeightFilter
+	keyFilter    *KeyFilter
+	anonymizer   *Anonymizer
+	manifest     *Manifest
 )
 
+// retryBackoff is the first interval of retry; it is doubled up to
+// maxRetryBackoff.
+const retryBackoff time.Duration = time.Second
+const maxRetryBackoff time.Duration = time.Second * 30
+
 var allPrefixes []string = []string{
 	common.BlockPrefixHash,
 	common.BlockPrefixConfirmed,
@@ -104,6 +149,16 @@ var allPrefixesByName map[string]string
 var cmd *cobra.Command
 var dumpCmd *cobra.Command
 var importCmd *cobra.Command
+var verifyCmd *cobra.Command
+var diffCmd *cobra.Command
+var compactCmd *cobra.Command
+var repairCmd *cobra.Command
+var statsCmd *cobra.Command
+var reindexCmd *cobra.Command
+var truncateCmd *cobra.Command
+var getCmd *cobra.Command
+var scanCmd *cobra.Command
+var generateCmd *cobra.Command
 
 var dumpExampleTemplate = `
 $ sebak-storage dump http://localhost:54321/jsonrpc /sebak-dumped
@@ -122,6 +177,34 @@ $ sebak-storage dump --format json http://localhost:54321/jsonrpc /sebak-dumped
 {{ index . "line" }}
 Dump storage to '/sebak-dumped' as gzipped json files
 
+$ sebak-storage dump --format json-decoded http://localhost:54321/jsonrpc /sebak-dumped
+{{ index . "line" }}
+Dump storage to '/sebak-dumped' as gzipped json files with decoded values; it can not be imported
+
+$ sebak-storage dump --format sqlite http://localhost:54321/jsonrpc /sebak-dumped
+{{ index . "line" }}
+Dump blocks, transactions, operations and accounts to '/sebak-dumped/sebak.sqlite' as sql
+tables; it can not be imported
+
+$ sebak-storage dump --format jsonl http://localhost:54321/jsonrpc - | gzip > /sebak-dumped.jsonl.gz
+{{ index . "line" }}
+Dump storage to stdout, '-' as json lines, which have their prefix names; the log is written to
+stderr, and checkpoint and manifest are not saved
+
+$ sebak-storage dump --format json http://localhost:54321/jsonrpc s3://sebak-backup/dumped
+{{ index . "line" }}
+Dump storage to the 'dumped' path of s3 bucket, 'sebak-backup' as gzipped json files; the
+credentials are loaded from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+
+$ sebak-storage dump --format json --s3-endpoint http://localhost:9000 /sebak-db s3://sebak-backup/dumped
+{{ index . "line" }}
+Dump local storage, '/sebak-db' to the s3 compatible storage, like minio
+
+$ sebak-storage dump --anonymize --strip-memo --strip-signature http://localhost:54321/jsonrpc /sebak-dumped
+{{ index . "line" }}
+Dump storage to '/sebak-dumped' with the account addresses replaced by random addresses
+consistently and without memos and signatures; the hashes and signatures can not be verified
+
 $ sebak-storage dump --list-prefix
 {{ index . "line" }}
 Print all prefixes
@@ -129,15 +212,190 @@ Print all prefixes
 $ sebak-storage dump --prefix block-hash /sebak-db /sebak-dumped
 {{ index . "line" }}
 Dump local storage, '/sebak-db' to '/sebak-dumped'; only 'block-hash' prefixed data
+
+$ sebak-storage dump --incremental http://localhost:54321/jsonrpc /sebak-dumped
+{{ index . "line" }}
+Dump storage to '/sebak-dumped' continuing from the checkpoint of the last dump; the new
+blocks, transactions and operations are appended and the other prefixes are dumped again.
+If the last dump failed, the blocks, transactions and operations are also dumped again
+
+$ sebak-storage dump --since-height 1000 http://localhost:54321/jsonrpc /sebak-dumped
+{{ index . "line" }}
+Dump storage to '/sebak-dumped'; blocks, transactions and operations only after block height, 1000
+
+$ sebak-storage dump --prefix block-account-address --start-key GA --end-key GB --limit 100 /sebak-db /sebak-dumped
+{{ index . "line" }}
+Dump at most 100 accounts, which address is from 'GA' to before 'GB'
+
+$ sebak-storage dump --address GDIRF4UWPACXPPI4GW7CMTACTCNDIKJEHZK44RITZB4TD3YUM6CCVNGJ /sebak-db /sebak-dumped
+{{ index . "line" }}
+Dump the operations, transactions and account of the address; the indexes, which have only
+the hash like 'block-operation-blockheight' are not dumped, so it can not be imported
 `
 
 var importExampleTemplate = `
 $ sebak-storage import /sebak-dumped /sebak-new-storage
 {{ index . "line" }}
-Import dumped directory, '/sebak-dumped' to '/sebak-new-storage'
+Import dumped directory, '/sebak-dumped' to '/sebak-new-storage'; if the last import to
+'/sebak-new-storage' was interrupted, it will be resumed; the interrupted import can be
+resumed only from the same dump directory
+
+$ sebak-storage import --workers 8 --batch-size 50000 /sebak-dumped /sebak-new-storage
+{{ index . "line" }}
+Import dumped directory with 8 files at once, writing 50000 items in one batch
+
+$ sebak-storage import /sebak-dumped-leveldb /sebak-new-storage
+{{ index . "line" }}
+Import the leveldb dump, '/sebak-dumped-leveldb'; it is imported by prefix
+
+$ ssh node0 sebak-storage dump --format jsonl /sebak-db - | sebak-storage import - /sebak-new-storage
+{{ index . "line" }}
+Import the jsonl stream from stdin, '-'; the stream from stdin can not be resumed
+
+$ sebak-storage import --merge --conflict overwrite /sebak-dumped-accounts /sebak-new-storage
+{{ index . "line" }}
+Merge the dump into the existing storage, '/sebak-new-storage'; the same items are skipped and
+the different items are overwritten. With '--conflict skip', the existing items are kept and
+with '--conflict fail', the default, import stops at the first different item
+`
+
+var verifyExampleTemplate = `
+$ sebak-storage verify http://localhost:54321/jsonrpc
+{{ index . "line" }}
+Verify storage thru jsonrpc
+
+$ sebak-storage verify /sebak-dumped
+{{ index . "line" }}
+Verify local storage, '/sebak-dumped'
+`
+
+var diffExampleTemplate = `
+$ sebak-storage diff http://node-a:54321/jsonrpc http://node-b:54321/jsonrpc
+{{ index . "line" }}
+Print the number of differing keys by prefix of two storages thru jsonrpc
+
+$ sebak-storage diff --format jsonl /sebak-db http://localhost:54321/jsonrpc
+{{ index . "line" }}
+Print the added, removed and changed keys of local storage, '/sebak-db' and jsonrpc as json lines
+
+$ sebak-storage diff --prefix block-account-address /sebak-db-a /sebak-db-b
+{{ index . "line" }}
+Print the differing keys of two local storages; only 'block-account-address' prefixed data
+`
+
+var compactExampleTemplate = `
+$ sebak-storage compact /sebak-db
+{{ index . "line" }}
+Compact the whole local storage, '/sebak-db' and print the size before and after
+
+$ sebak-storage compact --prefix block-operation-source --prefix block-operation-target /sebak-db
+{{ index . "line" }}
+Compact only 'block-operation-source' and 'block-operation-target' prefixed data
+
+$ sebak-storage compact --prefix block-account-address --start-key GA --end-key GB /sebak-db
+{{ index . "line" }}
+Compact 'block-account-address' prefixed data, which key is from 'GA' to before 'GB'
+`
+
+var repairExampleTemplate = `
+$ sebak-storage repair /sebak-db
+{{ index . "line" }}
+Recover local storage, '/sebak-db', which can not be opened
+`
+
+var statsExampleTemplate = `
+$ sebak-storage stats http://localhost:54321/jsonrpc
+{{ index . "line" }}
+Print the number of keys and the size of keys and values by prefix thru jsonrpc
+
+$ sebak-storage stats --top 20 --prefix block-operation-hash /sebak-db
+{{ index . "line" }}
+Print the statistics of 'block-operation-hash' prefixed data of local storage with the
+largest 20 items
+`
+
+var reindexExampleTemplate = `
+$ sebak-storage reindex /sebak-db
+{{ index . "line" }}
+Drop the index prefixes of local storage, '/sebak-db' and regenerate them from the blocks,
+transactions and operations; the records are saved again in transaction, so they are not
+lost by interruption. The order of 'block-account-created' is kept and only the missing
+accounts are added
+
+$ sebak-storage dump --format json --prefix block-hash --prefix block-transaction-hash --prefix block-operation-hash --prefix block-account-address http://localhost:54321/jsonrpc /sebak-dumped
+$ sebak-storage import /sebak-dumped /sebak-db
+$ sebak-storage reindex /sebak-db
+{{ index . "line" }}
+Dump and import only the primary prefixes and rebuild the indexes locally
+`
+
+var truncateExampleTemplate = `
+$ sebak-storage truncate --height 1000 --dry-run /sebak-db
+{{ index . "line" }}
+Print the keys to be deleted and the accounts to be rolled back to block height, 1000
+
+$ sebak-storage truncate --height 1000 /sebak-db
+{{ index . "line" }}
+Remove the blocks, transactions and operations after block height, 1000 with their indexes;
+the sequence id and balance of accounts are restored from 'block-account-sequenceid' at the
+sequence id of the height; the accounts, which only received by the removed operations are
+rolled back by the received amounts. Everything is written in one batch, so the storage is
+not changed if the truncation fails
+`
+
+var getExampleTemplate = `
+$ sebak-storage get http://localhost:54321/jsonrpc block-account-address:GDIRF4UWPACXPPI4GW7CMTACTCNDIKJEHZK44RITZB4TD3YUM6CCVNGJ
+{{ index . "line" }}
+Print the account thru jsonrpc; the key is '<prefix name>:<key without prefix>'
+
+$ sebak-storage get /sebak-db block-hash:8sHjLiSDJkqhT7CGeWmUjUcrXCy8JsPXBK1HCE3jEbqQ
+{{ index . "line" }}
+Print the block of local storage, '/sebak-db'
+`
+
+var scanExampleTemplate = `
+$ sebak-storage scan --prefix block-account-address --limit 20 http://localhost:54321/jsonrpc
+{{ index . "line" }}
+Print the first 20 accounts thru jsonrpc
+
+$ sebak-storage scan --prefix block-height --reverse --limit 1 /sebak-db
+{{ index . "line" }}
+Print the latest block height of local storage, '/sebak-db'
+
+$ sebak-storage scan --prefix block-account-address --start-key GD /sebak-db
+{{ index . "line" }}
+Print the accounts from 'GD'
+`
+
+var generateExampleTemplate = `
+$ sebak-storage generate --network-id 'sebak-test-network' /sebak-generated
+{{ index . "line" }}
+Generate 100 blocks with 100 accounts to '/sebak-generated'
+
+$ sebak-storage generate --network-id 'sebak-test-network' --seed 7 --blocks 10000 --accounts 5000 --txs-per-block 50 /sebak-generated
+{{ index . "line" }}
+Generate 10000 blocks with 5000 accounts and up to 50 transactions in each block; the same
+seed generates the same storage
+
+$ sebak-storage generate --network-id 'sebak-test-network' --mix payment:50,freezing:30,unfreezing:20 /sebak-generated
+{{ index . "line" }}
+Generate with more freezing and unfreezing operations; '--mix' is the weight of operation types,
+{payment, create-account, freezing, unfreezing}
+
+$ sebak-storage generate --network-id 'sebak-test-network' --unfreezing-period 10 /sebak-generated
+{{ index . "line" }}
+Generate with the short unfreezing period; the frozen balance is paid back to the linked account
+10 blocks after the unfreezing request
 `
 
 func init() {
+	{ // make allPrefixesByName
+		allPrefixesByName = map[string]string{}
+		for prefix, name := range allPrefixesWithName {
+			allPrefixesByName[name] = prefix
+		}
+	}
+
 	cmd = &cobra.Command{
 		Use:   os.Args[0],
 		Short: "sebak-storage",
@@ -167,7 +425,9 @@ func init() {
 			Run: func(c *cobra.Command, args []string) {
 				parseFlagsDump(args)
 
-				dump()
+				if !dump() {
+					os.Exit(1)
+				}
 			},
 		}
 
@@ -177,7 +437,22 @@ func init() {
 		dumpCmd.Flags().BoolVar(&flagForce, "force", flagForce, "clean up by force")
 		dumpCmd.Flags().Var(&flagPrefix, "prefix", "set prefix")
 		dumpCmd.Flags().BoolVar(&flagListPrefix, "list-prefix", flagListPrefix, "list all prefixes")
-		dumpCmd.Flags().StringVar(&flagOutputFormat, "format", flagOutputFormat, "output format; {'leveldb', 'json'}")
+		dumpCmd.Flags().StringVar(&flagOutputFormat, "format", flagOutputFormat, "output format; {'leveldb', 'json', 'json-decoded', 'sqlite', 'jsonl'}")
+		dumpCmd.Flags().BoolVar(&flagIncremental, "incremental", flagIncremental, "continue from the checkpoint of the last dump")
+		dumpCmd.Flags().StringVar(&flagNetworkID, "network-id", flagNetworkID, "network id of source; it is recorded in manifest")
+		dumpCmd.Flags().Uint64Var(&flagSinceHeight, "since-height", flagSinceHeight, "dump blocks, transactions and operations after this block height")
+		dumpCmd.Flags().IntVar(&flagRetry, "retry", flagRetry, "number of retries of the failed jsonrpc request")
+		dumpCmd.Flags().DurationVar(&flagSnapshotKeepAlive, "snapshot-keep-alive", flagSnapshotKeepAlive, "interval to keep jsonrpc snapshot alive; 0 disables it")
+		dumpCmd.Flags().StringVar(&flagS3Region, "s3-region", flagS3Region, "s3 region")
+		dumpCmd.Flags().StringVar(&flagS3Endpoint, "s3-endpoint", flagS3Endpoint, "endpoint of s3 compatible storage, like minio")
+		dumpCmd.Flags().IntVar(&flagWorkers, "workers", flagWorkers, "with s3 output, number of prefixes dumped at once")
+		dumpCmd.Flags().BoolVar(&flagAnonymize, "anonymize", flagAnonymize, "replace account addresses with random addresses")
+		dumpCmd.Flags().BoolVar(&flagStripMemo, "strip-memo", flagStripMemo, "with --anonymize, remove memos")
+		dumpCmd.Flags().BoolVar(&flagStripSignature, "strip-signature", flagStripSignature, "with --anonymize, remove signatures")
+		dumpCmd.Flags().StringVar(&flagStartKey, "start-key", flagStartKey, "dump the items from this key; key does not include prefix")
+		dumpCmd.Flags().StringVar(&flagEndKey, "end-key", flagEndKey, "dump the items before this key; key does not include prefix")
+		dumpCmd.Flags().Uint64Var(&flagLimit, "limit", flagLimit, "maximum number of items of each prefix")
+		dumpCmd.Flags().StringVar(&flagAddress, "address", flagAddress, "dump the operations, transactions and account, which are related with this address; it can not be imported")
 
 		cmd.AddCommand(dumpCmd)
 	}
@@ -190,8 +465,8 @@ func init() {
 		}
 
 		importCmd = &cobra.Command{
-			Use:     "import <json dump directory> <output directory>",
-			Short:   "import json dumped directory to leveldb",
+			Use:     "import <dump directory> <output directory>",
+			Short:   "import json or leveldb dumped directory to leveldb",
 			Args:    cobra.ExactArgs(2),
 			Example: b.String(),
 			Run: func(c *cobra.Command, args []string) {
@@ -205,7 +480,305 @@ func init() {
 		importCmd.Flags().StringVar(&flagLogFormat, "log-format", flagLogFormat, "log format, {terminal, json}")
 		importCmd.Flags().StringVar(&flagLog, "log", flagLog, "set log file")
 		importCmd.Flags().BoolVar(&flagForce, "force", flagForce, "clean up by force")
+		importCmd.Flags().IntVar(&flagBatchSize, "batch-size", flagBatchSize, "number of items in one batch")
+		importCmd.Flags().BoolVar(&flagIgnoreManifest, "ignore-manifest", flagIgnoreManifest, "import even if manifest does not match with files")
+		importCmd.Flags().IntVar(&flagWorkers, "workers", flagWorkers, "number of files to be imported at once")
+		importCmd.Flags().BoolVar(&flagMerge, "merge", flagMerge, "merge into the existing storage")
+		importCmd.Flags().StringVar(&flagConflict, "conflict", flagConflict, "with --merge, policy for the different items, {skip, overwrite, fail}")
 
 		cmd.AddCommand(importCmd)
 	}
+	{
+		t := template.Must(template.New("example-verify").Parse(verifyExampleTemplate))
+		var b bytes.Buffer
+		if err := t.Execute(&b, map[string]string{"line": strings.Repeat("-", termWidth-1)}); err != nil {
+			cmdcommon.PrintError(verifyCmd, err)
+		}
+
+		verifyCmd = &cobra.Command{
+			Use:     "verify <source>",
+			Short:   "verify the integrity of storage",
+			Args:    cobra.ExactArgs(1),
+			Example: b.String(),
+			Run: func(c *cobra.Command, args []string) {
+				parseFlagsVerify(args)
+
+				if !verify() {
+					os.Exit(1)
+				}
+			},
+		}
+
+		verifyCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+		verifyCmd.Flags().StringVar(&flagLogFormat, "log-format", flagLogFormat, "log format, {terminal, json}")
+		verifyCmd.Flags().StringVar(&flagLog, "log", flagLog, "set log file")
+
+		cmd.AddCommand(verifyCmd)
+	}
+	{
+		t := template.Must(template.New("example-diff").Parse(diffExampleTemplate))
+		var b bytes.Buffer
+		if err := t.Execute(&b, map[string]string{"line": strings.Repeat("-", termWidth-1)}); err != nil {
+			cmdcommon.PrintError(diffCmd, err)
+		}
+
+		diffCmd = &cobra.Command{
+			Use:     "diff <source-a> <source-b>",
+			Short:   "print the differing keys of two storages",
+			Args:    cobra.ExactArgs(2),
+			Example: b.String(),
+			Run: func(c *cobra.Command, args []string) {
+				parseFlagsDiff(args)
+
+				if !diff() {
+					os.Exit(1)
+				}
+			},
+		}
+
+		diffCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+		diffCmd.Flags().StringVar(&flagLogFormat, "log-format", flagLogFormat, "log format, {terminal, json}")
+		diffCmd.Flags().StringVar(&flagLog, "log", flagLog, "set log file")
+		diffCmd.Flags().Var(&flagPrefix, "prefix", "set prefix")
+		diffCmd.Flags().StringVar(&flagDiffFormat, "format", flagDiffFormat, "output format; {'summary', 'jsonl'}")
+
+		cmd.AddCommand(diffCmd)
+	}
+	{
+		t := template.Must(template.New("example-compact").Parse(compactExampleTemplate))
+		var b bytes.Buffer
+		if err := t.Execute(&b, map[string]string{"line": strings.Repeat("-", termWidth-1)}); err != nil {
+			cmdcommon.PrintError(compactCmd, err)
+		}
+
+		compactCmd = &cobra.Command{
+			Use:     "compact <db directory>",
+			Short:   "compact local storage",
+			Args:    cobra.ExactArgs(1),
+			Example: b.String(),
+			Run: func(c *cobra.Command, args []string) {
+				parseFlagsCompact(args)
+
+				if !compact() {
+					os.Exit(1)
+				}
+			},
+		}
+
+		compactCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+		compactCmd.Flags().StringVar(&flagLogFormat, "log-format", flagLogFormat, "log format, {terminal, json}")
+		compactCmd.Flags().StringVar(&flagLog, "log", flagLog, "set log file")
+		compactCmd.Flags().Var(&flagPrefix, "prefix", "set prefix")
+		compactCmd.Flags().StringVar(&flagStartKey, "start-key", flagStartKey, "compact from this key; with --prefix, key does not include prefix")
+		compactCmd.Flags().StringVar(&flagEndKey, "end-key", flagEndKey, "compact before this key; with --prefix, key does not include prefix")
+
+		cmd.AddCommand(compactCmd)
+	}
+	{
+		t := template.Must(template.New("example-repair").Parse(repairExampleTemplate))
+		var b bytes.Buffer
+		if err := t.Execute(&b, map[string]string{"line": strings.Repeat("-", termWidth-1)}); err != nil {
+			cmdcommon.PrintError(repairCmd, err)
+		}
+
+		repairCmd = &cobra.Command{
+			Use:     "repair <db directory>",
+			Short:   "recover broken local storage",
+			Args:    cobra.ExactArgs(1),
+			Example: b.String(),
+			Run: func(c *cobra.Command, args []string) {
+				parseFlagsRepair(args)
+
+				if !repair() {
+					os.Exit(1)
+				}
+			},
+		}
+
+		repairCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+		repairCmd.Flags().StringVar(&flagLogFormat, "log-format", flagLogFormat, "log format, {terminal, json}")
+		repairCmd.Flags().StringVar(&flagLog, "log", flagLog, "set log file")
+
+		cmd.AddCommand(repairCmd)
+	}
+	{
+		t := template.Must(template.New("example-stats").Parse(statsExampleTemplate))
+		var b bytes.Buffer
+		if err := t.Execute(&b, map[string]string{"line": strings.Repeat("-", termWidth-1)}); err != nil {
+			cmdcommon.PrintError(statsCmd, err)
+		}
+
+		statsCmd = &cobra.Command{
+			Use:     "stats <source>",
+			Short:   "print the statistics of storage by prefix",
+			Args:    cobra.ExactArgs(1),
+			Example: b.String(),
+			Run: func(c *cobra.Command, args []string) {
+				parseFlagsStats(args)
+
+				if !stats() {
+					os.Exit(1)
+				}
+			},
+		}
+
+		statsCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+		statsCmd.Flags().StringVar(&flagLogFormat, "log-format", flagLogFormat, "log format, {terminal, json}")
+		statsCmd.Flags().StringVar(&flagLog, "log", flagLog, "set log file")
+		statsCmd.Flags().Var(&flagPrefix, "prefix", "set prefix")
+		statsCmd.Flags().IntVar(&flagTop, "top", flagTop, "number of the largest items by prefix")
+
+		cmd.AddCommand(statsCmd)
+	}
+	{
+		t := template.Must(template.New("example-reindex").Parse(reindexExampleTemplate))
+		var b bytes.Buffer
+		if err := t.Execute(&b, map[string]string{"line": strings.Repeat("-", termWidth-1)}); err != nil {
+			cmdcommon.PrintError(reindexCmd, err)
+		}
+
+		reindexCmd = &cobra.Command{
+			Use:     "reindex <db directory>",
+			Short:   "rebuild the index prefixes of local storage from the primary records",
+			Args:    cobra.ExactArgs(1),
+			Example: b.String(),
+			Run: func(c *cobra.Command, args []string) {
+				parseFlagsReindex(args)
+
+				if !reindex() {
+					os.Exit(1)
+				}
+			},
+		}
+
+		reindexCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+		reindexCmd.Flags().StringVar(&flagLogFormat, "log-format", flagLogFormat, "log format, {terminal, json}")
+		reindexCmd.Flags().StringVar(&flagLog, "log", flagLog, "set log file")
+		reindexCmd.Flags().IntVar(&flagBatchSize, "batch-size", flagBatchSize, "number of deleted items or saved records in one batch")
+
+		cmd.AddCommand(reindexCmd)
+	}
+	{
+		t := template.Must(template.New("example-truncate").Parse(truncateExampleTemplate))
+		var b bytes.Buffer
+		if err := t.Execute(&b, map[string]string{"line": strings.Repeat("-", termWidth-1)}); err != nil {
+			cmdcommon.PrintError(truncateCmd, err)
+		}
+
+		truncateCmd = &cobra.Command{
+			Use:     "truncate --height <height> <db directory>",
+			Short:   "remove the blocks of local storage after the height",
+			Args:    cobra.ExactArgs(1),
+			Example: b.String(),
+			Run: func(c *cobra.Command, args []string) {
+				parseFlagsTruncate(args)
+
+				if !truncate() {
+					os.Exit(1)
+				}
+			},
+		}
+
+		truncateCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+		truncateCmd.Flags().StringVar(&flagLogFormat, "log-format", flagLogFormat, "log format, {terminal, json}")
+		truncateCmd.Flags().StringVar(&flagLog, "log", flagLog, "set log file")
+		truncateCmd.Flags().Uint64Var(&flagHeight, "height", flagHeight, "block height to be kept")
+		truncateCmd.Flags().BoolVar(&flagDryRun, "dry-run", flagDryRun, "print what would be deleted without deleting")
+
+		cmd.AddCommand(truncateCmd)
+	}
+	{
+		t := template.Must(template.New("example-get").Parse(getExampleTemplate))
+		var b bytes.Buffer
+		if err := t.Execute(&b, map[string]string{"line": strings.Repeat("-", termWidth-1)}); err != nil {
+			cmdcommon.PrintError(getCmd, err)
+		}
+
+		getCmd = &cobra.Command{
+			Use:     "get <source> <key>",
+			Short:   "print the decoded value of key",
+			Args:    cobra.ExactArgs(2),
+			Example: b.String(),
+			Run: func(c *cobra.Command, args []string) {
+				parseFlagsGet(args)
+
+				if !get(args[1]) {
+					os.Exit(1)
+				}
+			},
+		}
+
+		getCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+		getCmd.Flags().StringVar(&flagLogFormat, "log-format", flagLogFormat, "log format, {terminal, json}")
+		getCmd.Flags().StringVar(&flagLog, "log", flagLog, "set log file")
+
+		cmd.AddCommand(getCmd)
+	}
+	{
+		t := template.Must(template.New("example-scan").Parse(scanExampleTemplate))
+		var b bytes.Buffer
+		if err := t.Execute(&b, map[string]string{"line": strings.Repeat("-", termWidth-1)}); err != nil {
+			cmdcommon.PrintError(scanCmd, err)
+		}
+
+		scanCmd = &cobra.Command{
+			Use:     "scan --prefix <prefix> <source>",
+			Short:   "print the decoded items of prefix",
+			Args:    cobra.ExactArgs(1),
+			Example: b.String(),
+			Run: func(c *cobra.Command, args []string) {
+				parseFlagsScan(args)
+
+				if !scan() {
+					os.Exit(1)
+				}
+			},
+		}
+
+		scanCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+		scanCmd.Flags().StringVar(&flagLogFormat, "log-format", flagLogFormat, "log format, {terminal, json}")
+		scanCmd.Flags().StringVar(&flagLog, "log", flagLog, "set log file")
+		scanCmd.Flags().Var(&flagPrefix, "prefix", "set prefix")
+		scanCmd.Flags().Uint64Var(&flagScanLimit, "limit", flagScanLimit, "number of items")
+		scanCmd.Flags().BoolVar(&flagReverse, "reverse", flagReverse, "scan in reverse order")
+		scanCmd.Flags().StringVar(&flagStartKey, "start-key", flagStartKey, "scan from this key; key does not include prefix")
+
+		cmd.AddCommand(scanCmd)
+	}
+	{
+		t := template.Must(template.New("example-generate").Parse(generateExampleTemplate))
+		var b bytes.Buffer
+		if err := t.Execute(&b, map[string]string{"line": strings.Repeat("-", termWidth-1)}); err != nil {
+			cmdcommon.PrintError(generateCmd, err)
+		}
+
+		generateCmd = &cobra.Command{
+			Use:     "generate <output directory>",
+			Short:   "generate the synthetic storage for testing",
+			Args:    cobra.ExactArgs(1),
+			Example: b.String(),
+			Run: func(c *cobra.Command, args []string) {
+				parseFlagsGenerate(args)
+
+				if !generate() {
+					os.Exit(1)
+				}
+			},
+		}
+
+		generateCmd.Flags().StringVar(&flagLogLevel, "log-level", flagLogLevel, "log level, {crit, error, warn, info, debug}")
+		generateCmd.Flags().StringVar(&flagLogFormat, "log-format", flagLogFormat, "log format, {terminal, json}")
+		generateCmd.Flags().StringVar(&flagLog, "log", flagLog, "set log file")
+		generateCmd.Flags().BoolVar(&flagForce, "force", flagForce, "clean up by force")
+		generateCmd.Flags().StringVar(&flagNetworkID, "network-id", flagNetworkID, "network id for signing transactions")
+		generateCmd.Flags().Int64Var(&flagGenerateSeed, "seed", flagGenerateSeed, "seed of random")
+		generateCmd.Flags().Uint64Var(&flagGenerateBlocks, "blocks", flagGenerateBlocks, "number of blocks including genesis block")
+		generateCmd.Flags().IntVar(&flagGenerateAccounts, "accounts", flagGenerateAccounts, "maximum number of accounts")
+		generateCmd.Flags().IntVar(&flagGenerateTxs, "txs-per-block", flagGenerateTxs, "maximum number of transactions in block")
+		generateCmd.Flags().IntVar(&flagGenerateOps, "ops-per-tx", flagGenerateOps, "maximum number of operations in transaction")
+		generateCmd.Flags().StringVar(&flagGenerateMix, "mix", flagGenerateMix, "weights of operation types")
+		generateCmd.Flags().Uint64Var(&flagUnfreezingPeriod, "unfreezing-period", flagUnfreezingPeriod, "number of blocks from unfreezing request to payout")
+
+		cmd.AddCommand(generateCmd)
+	}
 }
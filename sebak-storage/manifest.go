@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"boscoin.io/sebak/lib/common"
+)
+
+const manifestFileName string = "manifest.json"
+
+// manifestSkipFiles are not the dumped data, so they are not in manifest.
+var manifestSkipFiles map[string]bool = map[string]bool{
+	manifestFileName:     true,
+	checkpointFileName:   true,
+	importMarkerFileName: true,
+	"LOCK":               true,
+	"LOG":                true,
+	"LOG.old":            true,
+}
+
+// Manifest describes the dump directory. Height and BlockHash are the latest
+// block of the snapshot, which the items are dumped from. Address is set for
+// the dump of `--address`, which can not be imported.
+type Manifest struct {
+	sync.Mutex
+
+	Source    string            `json:"source"`
+	NetworkID string            `json:"network_id"`
+	Height    uint64            `json:"height"`
+	BlockHash string            `json:"block_hash"`
+	Snapshot  string            `json:"snapshot"`
+	Format    string            `json:"format"`
+	Address   string            `json:"address,omitempty"`
+	Created   string            `json:"created"`
+	Counts    map[string]uint64 `json:"counts"`
+	Files     map[string]string `json:"files"`
+}
+
+func NewManifest() *Manifest {
+	return &Manifest{
+		Counts: map[string]uint64{},
+		Files:  map[string]string{},
+	}
+}
+
+func loadManifest(directory string) (*Manifest, error) {
+	b, err := ioutil.ReadFile(filepath.Join(directory, manifestFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	m := NewManifest()
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// SetCount sets the number of dumped items of prefix.
+func (m *Manifest) SetCount(prefix string, count int) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.Counts[allPrefixesWithName[prefix]] = uint64(count)
+}
+
+// AddCount adds the number of dumped items of prefix.
+func (m *Manifest) AddCount(prefix string, count int) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.Counts[allPrefixesWithName[prefix]] += uint64(count)
+}
+
+// Save collects the checksum of the files in store and saves manifest.
+func (m *Manifest) Save(store FileStore) error {
+	files, err := store.Checksums()
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.Files = files
+	m.Created = common.NowISO8601()
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return store.WriteFile(manifestFileName, b)
+}
+
+// Check compares the files in directory with manifest.
+func (m *Manifest) Check(directory string) error {
+	files, err := manifestFiles(directory)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range m.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if checksum, found := files[name]; !found {
+			return fmt.Errorf("file in manifest not found: %s", name)
+		} else if checksum != m.Files[name] {
+			return fmt.Errorf("checksum mismatch: %s", name)
+		}
+	}
+
+	for name := range files {
+		if _, found := m.Files[name]; !found {
+			return fmt.Errorf("file not in manifest: %s", name)
+		}
+	}
+
+	return nil
+}
+
+// manifestFiles returns the sha256 checksum of the dumped files.
+func manifestFiles(directory string) (map[string]string, error) {
+	fs, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]string{}
+	for _, f := range fs {
+		if f.IsDir() || manifestSkipFiles[f.Name()] {
+			continue
+		}
+
+		checksum, err := sha256File(filepath.Join(directory, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[f.Name()] = checksum
+	}
+
+	return files, nil
+}
+
+func sha256File(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
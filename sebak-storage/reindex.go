@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/syndtr/goleveldb/leveldb"
+
+	cmdcommon "boscoin.io/sebak/cmd/sebak/common"
+	"boscoin.io/sebak/lib/block"
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/node/runner"
+	"boscoin.io/sebak/lib/storage"
+	"boscoin.io/sebak/lib/transaction/operation"
+)
+
+// reindexPrimaryPrefixes are the primary prefixes in the order of reindex;
+// the record is saved again by SEBAK, so it's indexes are also stored. The
+// accounts are not saved again, `block-account-created` is rebuilt separately
+// by reindexAccountsCreated.
+var reindexPrimaryPrefixes []string = []string{
+	common.BlockPrefixHash,
+	common.BlockTransactionPrefixHash,
+	common.BlockOperationPrefixHash,
+}
+
+// reindexPrefixes are the index prefixes, which are dropped and regenerated
+// from the primary prefixes. `block-account-created` is not dropped, the order
+// of accounts can not be regenerated.
+var reindexPrefixes []string = []string{
+	common.BlockPrefixConfirmed,
+	common.BlockPrefixHeight,
+	common.BlockTransactionPrefixSource,
+	common.BlockTransactionPrefixConfirmed,
+	common.BlockTransactionPrefixAccount,
+	common.BlockTransactionPrefixBlock,
+	common.BlockOperationPrefixTxHash,
+	common.BlockOperationPrefixSource,
+	common.BlockOperationPrefixTarget,
+	common.BlockOperationPrefixPeers,
+	common.BlockOperationPrefixTypeSource,
+	common.BlockOperationPrefixTypeTarget,
+	common.BlockOperationPrefixTypePeers,
+	common.BlockOperationPrefixCreateFrozen,
+	common.BlockOperationPrefixFrozenLinked,
+	common.BlockOperationPrefixBlockHeight,
+}
+
+func parseFlagsReindex(args []string) {
+	parseLogging(reindexCmd)
+
+	if flagBatchSize < 1 {
+		cmdcommon.PrintFlagsError(reindexCmd, "--batch-size", fmt.Errorf("must be greater than 0"))
+	}
+
+	{ // check source
+		d, err := sourceDirectory(args[0])
+		if err != nil {
+			cmdcommon.PrintFlagsError(reindexCmd, "<db directory>", err)
+		}
+		flagSource = d
+
+		st, err := checkSourceDirectory(flagSource)
+		if err != nil {
+			cmdcommon.PrintFlagsError(reindexCmd, "<db directory>", err)
+		}
+		stLocal = st
+	}
+
+	parsedFlags := []interface{}{}
+	parsedFlags = append(parsedFlags, "\n\tlog-level", logLevel)
+	parsedFlags = append(parsedFlags, "\n\tlog-format", flagLogFormat)
+	parsedFlags = append(parsedFlags, "\n\tlog", flagLog)
+	parsedFlags = append(parsedFlags, "\n\tsource", flagSource)
+	parsedFlags = append(parsedFlags, "\n\tbatch-size", flagBatchSize)
+	parsedFlags = append(parsedFlags, "\n", "")
+
+	log.Debug("parsed flags:", parsedFlags...)
+}
+
+// walkSnapshot iterates all the items of prefix in the snapshot.
+func walkSnapshot(snapshot *storage.LevelDBBackend, prefix string, f func(storage.IterItem) error) error {
+	var cursor []byte
+	limit := runner.MaxLimitListOptions
+	for {
+		var items []storage.IterItem
+		it, closeFunc := snapshot.GetIterator(prefix, storage.NewDefaultListOptions(false, cursor, limit))
+		for {
+			item, hasNext := it()
+			if !hasNext {
+				break
+			}
+			items = append(items, item.Clone())
+		}
+		closeFunc()
+
+		for _, item := range items {
+			if cursor != nil && bytes.Equal(item.Key, cursor) {
+				continue
+			}
+
+			if err := f(item); err != nil {
+				return err
+			}
+		}
+
+		if len(items) < int(limit) {
+			break
+		}
+		cursor = items[len(items)-1].Key
+	}
+
+	return nil
+}
+
+// dropPrefix deletes all the items of prefix.
+func dropPrefix(snapshot *storage.LevelDBBackend, prefix string) (int, error) {
+	var count int
+	batch := new(leveldb.Batch)
+	err := walkSnapshot(snapshot, prefix, func(item storage.IterItem) error {
+		batch.Delete(item.Key)
+		count += 1
+
+		if batch.Len() < flagBatchSize {
+			return nil
+		}
+
+		defer batch.Reset()
+		return stLocal.Core.Write(batch, nil)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	if batch.Len() > 0 {
+		if err := stLocal.Core.Write(batch, nil); err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// resaveRecord deletes the primary record and saves it again in the
+// transaction, so it's indexes are stored by SEBAK; the record is not lost even
+// if the transaction is not committed. The block height of the created account
+// is kept in createdHeights.
+func resaveRecord(ts *storage.LevelDBBackend, prefix string, item storage.IterItem, createdHeights map[string]uint64) error {
+	if err := ts.Core.Delete(item.Key, nil); err != nil {
+		return err
+	}
+
+	switch prefix {
+	case common.BlockPrefixHash:
+		var blk block.Block
+		if err := json.Unmarshal(item.Value, &blk); err != nil {
+			return err
+		}
+		return blk.Save(ts)
+	case common.BlockTransactionPrefixHash:
+		var bt block.BlockTransaction
+		if err := json.Unmarshal(item.Value, &bt); err != nil {
+			return err
+		}
+		return bt.Save(ts)
+	case common.BlockOperationPrefixHash:
+		var bo block.BlockOperation
+		if err := json.Unmarshal(item.Value, &bo); err != nil {
+			return err
+		}
+		if bo.Type == operation.TypeCreateAccount {
+			createdHeights[bo.Target] = bo.Height
+		}
+		return bo.Save(ts)
+	}
+
+	return fmt.Errorf("unknown primary prefix: %s", allPrefixesWithName[prefix])
+}
+
+// resavePrefix saves again the records of prefix; `--batch-size` records are
+// committed in one transaction.
+func resavePrefix(snapshot *storage.LevelDBBackend, prefix string, createdHeights map[string]uint64) (int, error) {
+	var count int
+	var ts *storage.LevelDBBackend
+
+	commit := func() error {
+		if ts == nil {
+			return nil
+		}
+		defer func() {
+			ts = nil
+		}()
+
+		return ts.Commit()
+	}
+
+	err := walkSnapshot(snapshot, prefix, func(item storage.IterItem) error {
+		if ts == nil {
+			var err error
+			if ts, err = stLocal.OpenTransaction(); err != nil {
+				return err
+			}
+		}
+
+		if err := resaveRecord(ts, prefix, item, createdHeights); err != nil {
+			return fmt.Errorf("%s: %v", keyString(item.Key), err)
+		}
+
+		count += 1
+		if count%100000 == 0 {
+			log.Debug("records reindexed", "count", count, "prefix", allPrefixesWithName[prefix])
+		}
+
+		if count%flagBatchSize != 0 {
+			return nil
+		}
+
+		return commit()
+	})
+	if err != nil {
+		if ts != nil {
+			ts.Discard()
+		}
+		return count, err
+	}
+
+	return count, commit()
+}
+
+// reindexAccountsCreated rebuilds `block-account-created`. The order of the
+// existing index is kept; the items of unknown or duplicated accounts are
+// removed and the missing accounts are added after the last item in the order
+// of their create-account operations.
+func reindexAccountsCreated(snapshot *storage.LevelDBBackend, createdHeights map[string]uint64) error {
+	// indexed by address
+	accounts := map[string]bool{}
+	err := walkSnapshot(snapshot, common.BlockAccountPrefixAddress, func(item storage.IterItem) error {
+		var ac block.BlockAccount
+		if err := json.Unmarshal(item.Value, &ac); err != nil {
+			return fmt.Errorf("%s: %v", keyString(item.Key), err)
+		}
+		accounts[ac.Address] = false
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+
+	var removed int
+	lastKey := []byte(common.BlockAccountPrefixCreated)
+	err = walkSnapshot(snapshot, common.BlockAccountPrefixCreated, func(item storage.IterItem) error {
+		var address string
+		if err := json.Unmarshal(item.Value, &address); err != nil {
+			return fmt.Errorf("%s: %v", keyString(item.Key), err)
+		}
+
+		if indexed, found := accounts[address]; !found || indexed {
+			batch.Delete(item.Key)
+			removed += 1
+			return nil
+		}
+		accounts[address] = true
+		lastKey = item.Key
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for address, indexed := range accounts {
+		if !indexed {
+			missing = append(missing, address)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		a, b := createdHeights[missing[i]], createdHeights[missing[j]]
+		if a == b {
+			return missing[i] < missing[j]
+		}
+		return a < b
+	})
+
+	// the keys of the missing accounts are sorted after the last key
+	for i, address := range missing {
+		b, err := json.Marshal(address)
+		if err != nil {
+			return err
+		}
+
+		key := append([]byte{}, lastKey...)
+		key = append(key, []byte(fmt.Sprintf("-%020d", i))...)
+		batch.Put(key, b)
+	}
+
+	if err := stLocal.Core.Write(batch, nil); err != nil {
+		return err
+	}
+
+	log.Info(
+		"reindexed",
+		"prefix", allPrefixesWithName[common.BlockAccountPrefixCreated],
+		"count", len(accounts),
+		"added", len(missing),
+		"removed", removed,
+	)
+
+	return nil
+}
+
+func reindex() bool {
+	defer stLocal.Close()
+
+	snapshot, err := stLocal.OpenSnapshot()
+	if err != nil {
+		log.Error("failed to open snapshot", "error", err)
+		return false
+	}
+	defer snapshot.Core.(*storage.Snapshot).Release()
+
+	for _, prefix := range reindexPrefixes {
+		count, err := dropPrefix(snapshot, prefix)
+		if err != nil {
+			log.Error("failed to drop index", "prefix", allPrefixesWithName[prefix], "error", err)
+			return false
+		}
+		log.Debug("index dropped", "prefix", allPrefixesWithName[prefix], "count", count)
+	}
+
+	createdHeights := map[string]uint64{}
+	for _, prefix := range reindexPrimaryPrefixes {
+		count, err := resavePrefix(snapshot, prefix, createdHeights)
+		if err != nil {
+			log.Error("failed to reindex", "prefix", allPrefixesWithName[prefix], "error", err)
+			return false
+		}
+
+		log.Info("reindexed", "prefix", allPrefixesWithName[prefix], "count", count)
+	}
+
+	if err := reindexAccountsCreated(snapshot, createdHeights); err != nil {
+		log.Error("failed to reindex", "prefix", allPrefixesWithName[common.BlockAccountPrefixCreated], "error", err)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+
+	cmdcommon "boscoin.io/sebak/cmd/sebak/common"
+)
+
+func parseFlagsRepair(args []string) {
+	parseLogging(repairCmd)
+
+	{ // check source
+		d, err := sourceDirectory(args[0])
+		if err != nil {
+			cmdcommon.PrintFlagsError(repairCmd, "<db directory>", err)
+		}
+		flagSource = d
+	}
+
+	parsedFlags := []interface{}{}
+	parsedFlags = append(parsedFlags, "\n\tlog-level", logLevel)
+	parsedFlags = append(parsedFlags, "\n\tlog-format", flagLogFormat)
+	parsedFlags = append(parsedFlags, "\n\tlog", flagLog)
+	parsedFlags = append(parsedFlags, "\n\tsource", flagSource)
+	parsedFlags = append(parsedFlags, "\n", "")
+
+	log.Debug("parsed flags:", parsedFlags...)
+}
+
+// repair recovers the leveldb, which can not be opened; the manifest is
+// rebuilt from the table files.
+func repair() bool {
+	if st, err := checkSourceDirectory(flagSource); err == nil {
+		st.Close()
+		log.Info("storage can be opened; repair anyway", "directory", flagSource)
+	} else {
+		log.Debug("failed to open storage", "error", err, "directory", flagSource)
+	}
+
+	db, err := leveldb.RecoverFile(flagSource, nil)
+	if err != nil {
+		log.Error("failed to repair storage", "error", err, "directory", flagSource)
+		return false
+	}
+
+	if err := db.Close(); err != nil {
+		log.Error("failed to close repaired storage", "error", err, "directory", flagSource)
+		return false
+	}
+
+	log.Info("storage repaired", "directory", flagSource)
+
+	return true
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// s3UploadConcurrency is the number of parts uploaded at once by each upload;
+// the parts are buffered in memory, so it is lower than the default of
+// s3manager.
+const s3UploadConcurrency int = 2
+
+// isS3Output checks the output is s3 url, `s3://<bucket>/<path>`.
+func isS3Output(s string) bool {
+	return strings.HasPrefix(strings.ToLower(s), "s3://")
+}
+
+// S3FileStore uploads the files to the s3 compatible object storage. The files
+// are streamed by multipart upload, so the local disk is not used.
+type S3FileStore struct {
+	sync.Mutex
+
+	bucket    string
+	path      string
+	uploader  *s3manager.Uploader
+	checksums map[string]string
+}
+
+// NewS3FileStore parses `s3://<bucket>/<path>`; with endpoint, the s3
+// compatible storage like minio can be used. The credentials are loaded from
+// the environment variables or the shared credentials file of aws.
+func NewS3FileStore(s, region, endpoint string) (*S3FileStore, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(u.Host) < 1 {
+		return nil, fmt.Errorf("bucket not found: %s", s)
+	}
+
+	config := &aws.Config{Region: aws.String(region)}
+	if len(endpoint) > 0 {
+		config.Endpoint = aws.String(endpoint)
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+
+	uploader := s3manager.NewUploader(sess, func(u *s3manager.Uploader) {
+		u.Concurrency = s3UploadConcurrency
+	})
+
+	return &S3FileStore{
+		bucket:    u.Host,
+		path:      strings.Trim(u.Path, "/"),
+		uploader:  uploader,
+		checksums: map[string]string{},
+	}, nil
+}
+
+func (s *S3FileStore) key(name string) string {
+	return path.Join(s.path, name)
+}
+
+func (s *S3FileStore) upload(name string, body io.Reader) error {
+	_, err := s.uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(name)),
+		Body:   body,
+	})
+
+	return err
+}
+
+// Create starts the upload of the object; the written data is uploaded by
+// parts and the upload finishes when the object is closed. The object can not
+// be appended.
+func (s *S3FileStore) Create(name string, appending bool) (io.WriteCloser, error) {
+	if appending {
+		return nil, fmt.Errorf("s3 object can not be appended: %s", name)
+	}
+
+	pr, pw := io.Pipe()
+	o := &S3Object{
+		name:  name,
+		store: s,
+		pw:    pw,
+		h:     sha256.New(),
+		done:  make(chan error, 1),
+	}
+
+	go func() {
+		err := s.upload(name, pr)
+		pr.CloseWithError(err)
+		o.done <- err
+	}()
+
+	log.Debug("s3 upload started", "bucket", s.bucket, "key", s.key(name))
+
+	return o, nil
+}
+
+func (s *S3FileStore) WriteFile(name string, b []byte) error {
+	return s.upload(name, bytes.NewReader(b))
+}
+
+func (s *S3FileStore) Checksums() (map[string]string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	checksums := map[string]string{}
+	for name, checksum := range s.checksums {
+		checksums[name] = checksum
+	}
+
+	return checksums, nil
+}
+
+func (s *S3FileStore) String() string {
+	return fmt.Sprintf("s3://%s/%s", s.bucket, s.path)
+}
+
+func (s *S3FileStore) setChecksum(name, checksum string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.checksums[name] = checksum
+}
+
+// S3Object is the object being uploaded.
+type S3Object struct {
+	name  string
+	store *S3FileStore
+	pw    *io.PipeWriter
+	h     hash.Hash
+	done  chan error
+}
+
+func (o *S3Object) Write(b []byte) (int, error) {
+	o.h.Write(b)
+	return o.pw.Write(b)
+}
+
+// Close waits until the upload is finished.
+func (o *S3Object) Close() error {
+	if err := o.pw.Close(); err != nil {
+		return err
+	}
+
+	if err := <-o.done; err != nil {
+		return err
+	}
+
+	o.store.setChecksum(o.name, hex.EncodeToString(o.h.Sum(nil)))
+	log.Debug("s3 upload finished", "bucket", o.store.bucket, "key", o.store.key(o.name))
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is the minimal s3 compatible server for the path style requests; it
+// keeps the objects in memory and supports the single and multipart upload.
+type fakeS3 struct {
+	sync.Mutex
+
+	objects    map[string][]byte
+	uploads    map[string]map[int][]byte
+	multiparts int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		objects: map[string][]byte{},
+		uploads: map[string]map[int][]byte{},
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	_, initiate := query["uploads"]
+	uploadID := query.Get("uploadId")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && initiate:
+		uploadID = strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[uploadID] = map[int][]byte{}
+		fmt.Fprintf(
+			w,
+			`<InitiateMultipartUploadResult><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`,
+			key,
+			uploadID,
+		)
+	case r.Method == http.MethodPut && len(uploadID) > 0:
+		parts, found := f.uploads[uploadID]
+		if !found {
+			http.Error(w, "upload not found", http.StatusNotFound)
+			return
+		}
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, n))
+	case r.Method == http.MethodPost && len(uploadID) > 0:
+		parts, found := f.uploads[uploadID]
+		if !found {
+			http.Error(w, "upload not found", http.StatusNotFound)
+			return
+		}
+
+		var numbers []int
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+
+		var b []byte
+		for _, n := range numbers {
+			b = append(b, parts[n]...)
+		}
+		f.objects[key] = b
+		f.multiparts++
+		delete(f.uploads, uploadID)
+
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Key>%s</Key></CompleteMultipartUploadResult>`, key)
+	case r.Method == http.MethodDelete && len(uploadID) > 0:
+		delete(f.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	default:
+		http.Error(w, "not supported", http.StatusBadRequest)
+	}
+}
+
+func (f *fakeS3) object(key string) ([]byte, bool) {
+	f.Lock()
+	defer f.Unlock()
+
+	b, found := f.objects[key]
+	return b, found
+}
+
+func newTestS3FileStore(t *testing.T) (*fakeS3, *S3FileStore, func()) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "test")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+
+	store, err := NewS3FileStore("s3://sebak/dumped", "us-east-1", server.URL)
+	require.NoError(t, err)
+
+	return fake, store, server.Close
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func TestS3FileStoreMultipartUpload(t *testing.T) {
+	fake, store, closeFunc := newTestS3FileStore(t)
+	defer closeFunc()
+
+	// over the part size, so it is uploaded by multipart
+	b := make([]byte, s3manager.DefaultUploadPartSize*2+100)
+	rand.New(rand.NewSource(1)).Read(b)
+
+	o, err := store.Create("block-hash.json.gz", false)
+	require.NoError(t, err)
+
+	for i := 0; i < len(b); i += 1000 {
+		end := i + 1000
+		if end > len(b) {
+			end = len(b)
+		}
+		_, err := o.Write(b[i:end])
+		require.NoError(t, err)
+	}
+	require.NoError(t, o.Close())
+
+	uploaded, found := fake.object("sebak/dumped/block-hash.json.gz")
+	require.True(t, found)
+	require.True(t, bytes.Equal(b, uploaded))
+	require.Equal(t, 1, fake.multiparts)
+
+	checksums, err := store.Checksums()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"block-hash.json.gz": sha256Hex(b)}, checksums)
+}
+
+func TestS3FileStoreManifest(t *testing.T) {
+	fake, store, closeFunc := newTestS3FileStore(t)
+	defer closeFunc()
+
+	files := map[string][]byte{
+		"block-hash.json.gz":            []byte("block"),
+		"block-account-address.json.gz": []byte("account"),
+	}
+	for name, b := range files {
+		o, err := store.Create(name, false)
+		require.NoError(t, err)
+		_, err = o.Write(b)
+		require.NoError(t, err)
+		require.NoError(t, o.Close())
+	}
+
+	m := NewManifest()
+	m.Height = 10
+	require.NoError(t, m.Save(store))
+
+	b, found := fake.object("sebak/dumped/" + manifestFileName)
+	require.True(t, found)
+
+	saved := NewManifest()
+	require.NoError(t, json.Unmarshal(b, saved))
+	require.Equal(t, uint64(10), saved.Height)
+	require.Equal(t, len(files), len(saved.Files))
+	for name, b := range files {
+		uploaded, found := fake.object("sebak/dumped/" + name)
+		require.True(t, found)
+		require.Equal(t, sha256Hex(uploaded), saved.Files[name])
+		require.Equal(t, sha256Hex(b), saved.Files[name])
+	}
+}
+
+func TestS3FileStoreAppend(t *testing.T) {
+	_, store, closeFunc := newTestS3FileStore(t)
+	defer closeFunc()
+
+	_, err := store.Create("block-hash.json.gz", true)
+	require.Error(t, err)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"boscoin.io/sebak/lib/storage"
+)
+
+// streamPath is the output or input path for stdout and stdin.
+const streamPath string = "-"
+
+// OutputSink stores the dumped items.
+type OutputSink interface {
+	Write(prefix string, item storage.IterItem) error
+	Close() error
+}
+
+// PrefixCloser is the OutputSink, which can close the output of the finished
+// prefix before the other prefixes are finished.
+type PrefixCloser interface {
+	ClosePrefix(prefix string) error
+}
+
+// FileStore keeps the files of dump; local directory or object storage.
+type FileStore interface {
+	// Create opens the file to write; with appending, the written data is
+	// appended to the existing file, otherwise the file is overwritten.
+	Create(name string, appending bool) (io.WriteCloser, error)
+	WriteFile(name string, b []byte) error
+	// Checksums returns the sha256 checksum of the dumped files.
+	Checksums() (map[string]string, error)
+	String() string
+}
+
+// LocalFileStore keeps the files in the local directory.
+type LocalFileStore struct {
+	directory string
+}
+
+func NewLocalFileStore(directory string) *LocalFileStore {
+	return &LocalFileStore{directory: directory}
+}
+
+func (l *LocalFileStore) Create(name string, appending bool) (io.WriteCloser, error) {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appending {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	return os.OpenFile(filepath.Join(l.directory, name), flag, 0644)
+}
+
+func (l *LocalFileStore) WriteFile(name string, b []byte) error {
+	return ioutil.WriteFile(filepath.Join(l.directory, name), b, 0644)
+}
+
+func (l *LocalFileStore) Checksums() (map[string]string, error) {
+	return manifestFiles(l.directory)
+}
+
+func (l *LocalFileStore) String() string {
+	return l.directory
+}
+
+// LevelDBSink puts the items into the leveldb as they are.
+type LevelDBSink struct {
+	st *storage.LevelDBBackend
+}
+
+func NewLevelDBSink(st *storage.LevelDBBackend) *LevelDBSink {
+	return &LevelDBSink{st: st}
+}
+
+func (l *LevelDBSink) Write(prefix string, item storage.IterItem) error {
+	return l.st.Core.Put(item.Key, item.Value, nil)
+}
+
+func (l *LevelDBSink) Close() error {
+	return l.st.Close()
+}
+
+// StreamItem is the line of the `jsonl` stream; the items of all the prefixes
+// are interleaved, so each line has it's prefix name.
+type StreamItem struct {
+	Prefix string `json:"prefix"`
+	storage.IterItem
+}
+
+// StreamSink writes the items of all the prefixes into one json lines stream
+// like stdout.
+type StreamSink struct {
+	sync.Mutex
+
+	w io.WriteCloser
+}
+
+func NewStreamSink(w io.WriteCloser) *StreamSink {
+	return &StreamSink{w: w}
+}
+
+func (s *StreamSink) Write(prefix string, item storage.IterItem) error {
+	b, err := json.Marshal(StreamItem{Prefix: allPrefixesWithName[prefix], IterItem: item})
+	if err != nil {
+		return fmt.Errorf("failed to marshal StreamItem: %v", err)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	_, err = s.w.Write(append(b, []byte("\n")...))
+	return err
+}
+
+func (s *StreamSink) Close() error {
+	return s.w.Close()
+}
+
+// JSONSink writes the items of each prefix into the gzipped json file of the
+// FileStore; with decoded, the values are decoded by prefix.
+type JSONSink struct {
+	store   FileStore
+	decoded bool
+	files   *sync.Map
+}
+
+func NewJSONSink(store FileStore, decoded bool) *JSONSink {
+	return &JSONSink{store: store, decoded: decoded, files: &sync.Map{}}
+}
+
+func (j *JSONSink) file(prefix string) (*GzipWriter, error) {
+	if l, found := j.files.Load(prefix); found {
+		return l.(*GzipWriter), nil
+	}
+
+	name := allPrefixesWithName[prefix] + ".json.gz"
+	if j.decoded {
+		name = allPrefixesWithName[prefix] + ".decoded.json.gz"
+	}
+
+	w, err := j.store.Create(name, appendedPrefix(prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	f := NewGzipWriter(w)
+	j.files.Store(prefix, f)
+
+	return f, nil
+}
+
+func (j *JSONSink) Write(prefix string, item storage.IterItem) error {
+	f, err := j.file(prefix)
+	if err != nil {
+		return fmt.Errorf("failed to create GzipWriter: %v", err)
+	}
+
+	var b []byte
+	if j.decoded {
+		decoded, err := NewDecodedItem(prefix, item)
+		if err != nil {
+			return fmt.Errorf("failed to decode value: %s: %v", keyString(item.Key), err)
+		}
+		if b, err = json.Marshal(decoded); err != nil {
+			return fmt.Errorf("failed to marshal DecodedItem: %v", err)
+		}
+	} else if b, err = json.Marshal(item); err != nil {
+		return fmt.Errorf("failed to marshal storage.Item: %v", err)
+	}
+
+	_, err = f.Write(append(b, []byte("\n")...))
+	return err
+}
+
+// ClosePrefix closes the file of prefix; for s3, the upload of file is
+// finished, so it's buffers are released.
+func (j *JSONSink) ClosePrefix(prefix string) error {
+	l, found := j.files.Load(prefix)
+	if !found {
+		return nil
+	}
+	j.files.Delete(prefix)
+
+	return l.(*GzipWriter).Close()
+}
+
+func (j *JSONSink) Close() error {
+	var err error
+	j.files.Range(func(k, v interface{}) bool {
+		if e := v.(*GzipWriter).Close(); e != nil {
+			log.Error("failed to close gzip file", "prefix", allPrefixesWithName[k.(string)], "error", e)
+			err = e
+		}
+		return true
+	})
+
+	return err
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	jsonrpc "github.com/gorilla/rpc/json"
+
+	"boscoin.io/sebak/lib/block"
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/node/runner"
+	"boscoin.io/sebak/lib/storage"
+)
+
+// Source is the storage to be read, local storage or jsonrpc.
+type Source struct {
+	st       *storage.LevelDBBackend
+	stOrig   *storage.LevelDBBackend
+	endpoint *common.Endpoint
+	snapshot string
+	// snapshotOpened is the time when the local snapshot is opened
+	snapshotOpened string
+	// snapshotExpired is set when the snapshot of jsonrpc is not found
+	snapshotExpired int32
+}
+
+// errSnapshotExpired means the snapshot of jsonrpc was released or expired;
+// the items from the new snapshot are not consistent with the dumped items.
+var errSnapshotExpired error = fmt.Errorf("snapshot expired or released")
+
+func isSnapshotNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	s := strings.ToLower(err.Error())
+	return strings.Contains(s, "snapshot") && strings.Contains(s, "not found")
+}
+
+func NewSource(s string) (*Source, error) {
+	log.Debug("checking source", "source", s)
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		log.Debug("source is jsonrpc-based", "parsed", u)
+		endpoint, err := checkSourceJSONRpc(s)
+		if err != nil {
+			log.Error("failed to check jsonrpc endpoint", "error", err)
+			return nil, err
+		}
+
+		return &Source{endpoint: endpoint}, nil
+	default:
+		log.Debug("source is file-based", "parsed", u)
+		st, err := checkSourceDirectory(s)
+		if err != nil {
+			log.Error("failed to check file-based source", "error", err)
+			return nil, err
+		}
+
+		return &Source{st: st}, nil
+	}
+}
+
+func (s *Source) String() string {
+	if s.endpoint != nil {
+		return s.endpoint.String()
+	}
+
+	return "local storage"
+}
+
+func (s *Source) IsJSONRPC() bool {
+	return s.endpoint != nil
+}
+
+func (s *Source) request(method string, args interface{}) (*http.Response, error) {
+	return request(s.endpoint, method, args)
+}
+
+// OpenSnapshot opens the snapshot of the source.
+func (s *Source) OpenSnapshot() error {
+	if s.st != nil {
+		st, err := s.st.OpenSnapshot()
+		if err != nil {
+			return err
+		}
+		s.stOrig = s.st
+		s.st = st
+		s.snapshotOpened = common.NowISO8601()
+		log.Debug("local snapshot opened", "opened", s.snapshotOpened)
+	}
+
+	if s.endpoint != nil {
+		resp, err := s.request("DB.OpenSnapshot", &runner.DBOpenSnapshotResult{})
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		var result runner.DBOpenSnapshotResult
+		if err := jsonrpc.DecodeClientResponse(resp.Body, &result); err != nil {
+			return err
+		}
+
+		s.snapshot = result.Snapshot
+		log.Debug("snapshot opened", "result", result)
+	}
+
+	return nil
+}
+
+// ReleaseSnapshot releases the snapshot, which is opened by OpenSnapshot.
+func (s *Source) ReleaseSnapshot() {
+	if s.stOrig != nil {
+		s.st.Core.(*storage.Snapshot).Release()
+		s.st = s.stOrig
+		s.stOrig = nil
+		s.snapshotOpened = ""
+	}
+
+	if len(s.snapshot) < 1 {
+		return
+	}
+
+	resp, err := s.request("DB.ReleaseSnapshot", &runner.DBReleaseSnapshot{Snapshot: s.snapshot})
+	if err != nil {
+		log.Error("failed to ReleaseSnapshot", "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var result runner.DBReleaseSnapshotResult
+	if err := jsonrpc.DecodeClientResponse(resp.Body, &result); err != nil {
+		log.Error("failed to ReleaseSnapshot", "error", err)
+		return
+	}
+
+	s.snapshot = ""
+	log.Debug("snapshot released", "result", result)
+}
+
+// SnapshotID returns the id of the opened snapshot; the local snapshot does not
+// have id, so it is the time when it is opened.
+func (s *Source) SnapshotID() string {
+	if len(s.snapshotOpened) > 0 {
+		return "local:" + s.snapshotOpened
+	}
+
+	return s.snapshot
+}
+
+func (s *Source) SnapshotExpired() bool {
+	return atomic.LoadInt32(&s.snapshotExpired) == 1
+}
+
+func (s *Source) setSnapshotExpired() {
+	if atomic.CompareAndSwapInt32(&s.snapshotExpired, 0, 1) {
+		log.Error("snapshot expired or released", "snapshot", s.snapshot)
+	}
+}
+
+// KeepAlive touches the snapshot of jsonrpc by interval, so the snapshot is
+// not expired while the items are read slowly; if the snapshot is not found,
+// it is marked as expired. The returned function stops it.
+func (s *Source) KeepAlive(interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, err := s.Has(common.BlockPrefixHeight); isSnapshotNotFound(err) {
+					s.setSnapshotExpired()
+					return
+				} else if err != nil {
+					log.Warn("failed to keep snapshot alive", "error", err)
+				} else {
+					log.Debug("snapshot kept alive", "snapshot", s.snapshot)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+	}
+}
+
+// Close releases the snapshot and closes the local storage.
+func (s *Source) Close() {
+	s.ReleaseSnapshot()
+
+	if s.st != nil {
+		s.st.Close()
+	}
+}
+
+// GetIterator returns the items of the given prefix.
+func (s *Source) GetIterator(prefix string, cursor []byte, reverse bool, limit uint64) ([]storage.IterItem, error) {
+	if s.endpoint == nil {
+		var items []storage.IterItem
+		it, closeFunc := s.st.GetIterator(
+			prefix,
+			storage.NewDefaultListOptions(reverse, cursor, limit),
+		)
+		defer closeFunc()
+
+		for {
+			item, hasNext := it()
+			if !hasNext {
+				break
+			}
+			items = append(items, item.Clone())
+		}
+
+		return items, nil
+	}
+
+	args := runner.DBGetIteratorArgs{
+		Snapshot: s.snapshot,
+		Prefix:   prefix,
+		Options: runner.GetIteratorOptions{
+			Reverse: reverse,
+			Limit:   limit,
+			Cursor:  cursor,
+		},
+	}
+	result, err := s.getIteratorResult(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Items, nil
+}
+
+func (s *Source) getIteratorResult(args runner.DBGetIteratorArgs) (result runner.DBGetIteratorResult, err error) {
+	resp, err := s.request("DB.GetIterator", &args)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	err = jsonrpc.DecodeClientResponse(resp.Body, &result)
+	return
+}
+
+// Walk iterates all the items of the given prefix after cursor. If f returns
+// false, Walk stops.
+func (s *Source) Walk(prefix string, cursor []byte, f func(storage.IterItem) (bool, error)) error {
+	limit := runner.MaxLimitListOptions
+	for {
+		items, err := s.GetIterator(prefix, cursor, false, limit)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			if cursor != nil && bytes.Equal(item.Key, cursor) {
+				continue
+			}
+
+			if keep, err := f(item); err != nil {
+				return err
+			} else if !keep {
+				return nil
+			}
+		}
+
+		if len(items) < int(limit) {
+			break
+		}
+		cursor = items[len(items)-1].Key
+	}
+
+	return nil
+}
+
+// Has checks the key exists.
+func (s *Source) Has(key string) (bool, error) {
+	if s.endpoint == nil {
+		return s.st.Core.Has([]byte(key), nil)
+	}
+
+	args := runner.DBHasArgs{
+		Snapshot: s.snapshot,
+		Key:      key,
+	}
+	resp, err := s.request("DB.Has", &args)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var result runner.DBHasResult
+	if err := jsonrpc.DecodeClientResponse(resp.Body, &result); err != nil {
+		return false, err
+	}
+
+	return bool(result), nil
+}
+
+// Get returns the raw value of key.
+func (s *Source) Get(key string) ([]byte, error) {
+	if s.endpoint == nil {
+		return s.st.Core.Get([]byte(key), nil)
+	}
+
+	args := runner.DBGetArgs{
+		Snapshot: s.snapshot,
+		Key:      key,
+	}
+	resp, err := s.request("DB.Get", &args)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result runner.DBGetResult
+	if err := jsonrpc.DecodeClientResponse(resp.Body, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Value, nil
+}
+
+// LatestBlock returns the latest block.
+func (s *Source) LatestBlock() (blk block.Block, err error) {
+	var items []storage.IterItem
+	if items, err = s.GetIterator(common.BlockPrefixHeight, nil, true, 1); err != nil {
+		return
+	} else if len(items) < 1 {
+		err = fmt.Errorf("block not found")
+		return
+	}
+
+	var hash string
+	if err = json.Unmarshal(items[0].Value, &hash); err != nil {
+		return
+	}
+
+	var b []byte
+	if b, err = s.Get(fmt.Sprintf("%s%s", common.BlockPrefixHash, hash)); err != nil {
+		return
+	}
+
+	err = json.Unmarshal(b, &blk)
+	return
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"sync"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"boscoin.io/sebak/lib/block"
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/storage"
+)
+
+const sqliteFileName string = "sebak.sqlite"
+
+// sqliteBatchSize is the number of rows in one sqlite transaction.
+const sqliteBatchSize int = 10000
+
+// sqlitePrefixes are stored in the sqlite tables; the other prefixes are the
+// index of these, so they are not needed in sql.
+var sqlitePrefixes map[string]string = map[string]string{
+	common.BlockPrefixHash:            "blocks",
+	common.BlockTransactionPrefixHash: "transactions",
+	common.BlockOperationPrefixHash:   "operations",
+	common.BlockAccountPrefixAddress:  "accounts",
+}
+
+var sqliteSchema []string = []string{
+	`CREATE TABLE IF NOT EXISTS blocks (
+		hash TEXT PRIMARY KEY,
+		height INTEGER NOT NULL,
+		prev_block_hash TEXT,
+		total_txs INTEGER,
+		total_ops INTEGER,
+		proposer TEXT,
+		round INTEGER,
+		proposed_time TEXT,
+		confirmed TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS transactions (
+		hash TEXT PRIMARY KEY,
+		block TEXT NOT NULL,
+		source TEXT NOT NULL,
+		fee INTEGER,
+		amount INTEGER,
+		sequence_id INTEGER,
+		operations INTEGER,
+		confirmed TEXT,
+		created TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS operations (
+		hash TEXT PRIMARY KEY,
+		op_hash TEXT,
+		tx_hash TEXT NOT NULL,
+		height INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		source TEXT NOT NULL,
+		target TEXT,
+		body TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS accounts (
+		address TEXT PRIMARY KEY,
+		balance INTEGER,
+		sequence_id INTEGER,
+		linked TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS blocks_height ON blocks (height)`,
+	`CREATE INDEX IF NOT EXISTS transactions_block ON transactions (block)`,
+	`CREATE INDEX IF NOT EXISTS transactions_source ON transactions (source)`,
+	`CREATE INDEX IF NOT EXISTS operations_tx_hash ON operations (tx_hash)`,
+	`CREATE INDEX IF NOT EXISTS operations_height ON operations (height)`,
+	`CREATE INDEX IF NOT EXISTS operations_source ON operations (source)`,
+	`CREATE INDEX IF NOT EXISTS operations_target ON operations (target)`,
+	`CREATE INDEX IF NOT EXISTS operations_type ON operations (type)`,
+}
+
+// SQLiteWriter writes the blocks, transactions, operations and accounts into
+// the normalized sqlite tables. The rows are committed by sqliteBatchSize.
+type SQLiteWriter struct {
+	sync.Mutex
+
+	db    *sql.DB
+	tx    *sql.Tx
+	count int
+}
+
+func NewSQLiteWriter(directory string) (*SQLiteWriter, error) {
+	db, err := sql.Open("sqlite3", filepath.Join(directory, sqliteFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite allows only one writer
+	db.SetMaxOpenConns(1)
+
+	for _, q := range sqliteSchema {
+		if _, err := db.Exec(q); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return &SQLiteWriter{db: db}, nil
+}
+
+// Write inserts the item; the items of the prefixes, which are not in
+// sqlitePrefixes are ignored.
+func (s *SQLiteWriter) Write(prefix string, item storage.IterItem) error {
+	if _, found := sqlitePrefixes[prefix]; !found {
+		return nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.tx == nil {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		s.tx = tx
+	}
+
+	if err := s.insert(prefix, item.Value); err != nil {
+		return err
+	}
+
+	s.count += 1
+	if s.count < sqliteBatchSize {
+		return nil
+	}
+
+	return s.commit()
+}
+
+func (s *SQLiteWriter) insert(prefix string, b []byte) (err error) {
+	switch prefix {
+	case common.BlockPrefixHash:
+		var blk block.Block
+		if err = json.Unmarshal(b, &blk); err != nil {
+			return
+		}
+		_, err = s.tx.Exec(
+			"INSERT OR REPLACE INTO blocks VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			blk.Hash,
+			int64(blk.Height),
+			blk.PrevBlockHash,
+			int64(blk.TotalTxs),
+			int64(blk.TotalOps),
+			blk.Proposer,
+			int64(blk.Round),
+			blk.ProposedTime,
+			blk.Confirmed,
+		)
+	case common.BlockTransactionPrefixHash:
+		var bt block.BlockTransaction
+		if err = json.Unmarshal(b, &bt); err != nil {
+			return
+		}
+		_, err = s.tx.Exec(
+			"INSERT OR REPLACE INTO transactions VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			bt.Hash,
+			bt.Block,
+			bt.Source,
+			int64(bt.Fee),
+			int64(bt.Amount),
+			int64(bt.SequenceID),
+			len(bt.Operations),
+			bt.Confirmed,
+			bt.Created,
+		)
+	case common.BlockOperationPrefixHash:
+		var bo block.BlockOperation
+		if err = json.Unmarshal(b, &bo); err != nil {
+			return
+		}
+		_, err = s.tx.Exec(
+			"INSERT OR REPLACE INTO operations VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			bo.Hash,
+			bo.OpHash,
+			bo.TxHash,
+			int64(bo.Height),
+			string(bo.Type),
+			bo.Source,
+			bo.Target,
+			string(bo.Body),
+		)
+	case common.BlockAccountPrefixAddress:
+		var ac block.BlockAccount
+		if err = json.Unmarshal(b, &ac); err != nil {
+			return
+		}
+		_, err = s.tx.Exec(
+			"INSERT OR REPLACE INTO accounts VALUES (?, ?, ?, ?)",
+			ac.Address,
+			int64(ac.Balance),
+			int64(ac.SequenceID),
+			ac.Linked,
+		)
+	}
+
+	return
+}
+
+func (s *SQLiteWriter) commit() error {
+	if s.tx == nil {
+		return nil
+	}
+
+	err := s.tx.Commit()
+	s.tx = nil
+	s.count = 0
+
+	return err
+}
+
+// Close commits the remaining rows and closes the database.
+func (s *SQLiteWriter) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.commit(); err != nil {
+		s.db.Close()
+		return err
+	}
+
+	return s.db.Close()
+}
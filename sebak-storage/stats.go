@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	cmdcommon "boscoin.io/sebak/cmd/sebak/common"
+	"boscoin.io/sebak/lib/storage"
+)
+
+// StatsEntry is the key and it's value size.
+type StatsEntry struct {
+	Key  string
+	Size int
+}
+
+// PrefixStats is the statistics of the items of one prefix.
+type PrefixStats struct {
+	Prefix     string
+	Count      int
+	KeyBytes   int
+	ValueBytes int
+	MinValue   int
+	MaxValue   int
+	Largest    []StatsEntry
+}
+
+func (p PrefixStats) AvgValue() float64 {
+	if p.Count < 1 {
+		return 0
+	}
+
+	return float64(p.ValueBytes) / float64(p.Count)
+}
+
+// add counts the item and keeps the largest `--top` items.
+func (p *PrefixStats) add(item storage.IterItem) {
+	size := len(item.Value)
+	if p.Count < 1 || size < p.MinValue {
+		p.MinValue = size
+	}
+	if size > p.MaxValue {
+		p.MaxValue = size
+	}
+
+	p.Count += 1
+	p.KeyBytes += len(item.Key)
+	p.ValueBytes += size
+
+	if flagTop < 1 {
+		return
+	}
+
+	if len(p.Largest) >= flagTop && size <= p.Largest[len(p.Largest)-1].Size {
+		return
+	}
+
+	p.Largest = append(p.Largest, StatsEntry{Key: keyString(item.Key), Size: size})
+	sort.SliceStable(p.Largest, func(i, j int) bool {
+		return p.Largest[i].Size > p.Largest[j].Size
+	})
+	if len(p.Largest) > flagTop {
+		p.Largest = p.Largest[:flagTop]
+	}
+}
+
+func parseFlagsStats(args []string) {
+	parseFlagPrefix(statsCmd)
+
+	parseLogging(statsCmd)
+
+	if flagTop < 0 {
+		cmdcommon.PrintFlagsError(statsCmd, "--top", fmt.Errorf("must not be negative"))
+	}
+
+	{ // check source
+		flagSource = args[0]
+		if err := checkSource(flagSource); err != nil {
+			cmdcommon.PrintFlagsError(statsCmd, "<source>", err)
+		}
+	}
+
+	parsedFlags := []interface{}{}
+	parsedFlags = append(parsedFlags, "\n\tlog-level", logLevel)
+	parsedFlags = append(parsedFlags, "\n\tlog-format", flagLogFormat)
+	parsedFlags = append(parsedFlags, "\n\tlog", flagLog)
+	parsedFlags = append(parsedFlags, "\n\tsource", flagSource)
+	parsedFlags = append(parsedFlags, "\n\tprefix", flagPrefix)
+	parsedFlags = append(parsedFlags, "\n\ttop", flagTop)
+	parsedFlags = append(parsedFlags, "\n", "")
+
+	log.Debug("parsed flags:", parsedFlags...)
+}
+
+func statsPrefix(prefix string) (PrefixStats, error) {
+	p := PrefixStats{Prefix: allPrefixesWithName[prefix]}
+
+	err := source.Walk(prefix, nil, func(item storage.IterItem) (bool, error) {
+		p.add(item)
+
+		if p.Count%100000 == 0 {
+			log.Debug("got items", "count", p.Count, "prefix", p.Prefix)
+		}
+
+		return true, nil
+	})
+
+	return p, err
+}
+
+func printPrefixStats(p PrefixStats) {
+	fmt.Printf(
+		"%-34s count=%d key-bytes=%d value-bytes=%d min=%d max=%d avg=%.1f\n",
+		p.Prefix,
+		p.Count,
+		p.KeyBytes,
+		p.ValueBytes,
+		p.MinValue,
+		p.MaxValue,
+		p.AvgValue(),
+	)
+
+	for _, e := range p.Largest {
+		fmt.Printf("\t%d\t%s\n", e.Size, e.Key)
+	}
+}
+
+func stats() bool {
+	defer func() {
+		if source != nil {
+			source.Close()
+		}
+	}()
+
+	if err := source.OpenSnapshot(); err != nil {
+		log.Error("failed to OpenSnapshot", "error", err)
+		return false
+	}
+
+	var total PrefixStats
+	total.Prefix = "total"
+	for _, name := range flagPrefix {
+		p, err := statsPrefix(allPrefixesByName[name])
+		if err != nil {
+			log.Error("failed to get stats", "prefix", name, "error", err)
+			return false
+		}
+		log.Debug("stats finished", "prefix", name, "count", p.Count)
+
+		printPrefixStats(p)
+
+		if p.Count < 1 {
+			continue
+		}
+		if total.Count < 1 || p.MinValue < total.MinValue {
+			total.MinValue = p.MinValue
+		}
+		if p.MaxValue > total.MaxValue {
+			total.MaxValue = p.MaxValue
+		}
+		total.Count += p.Count
+		total.KeyBytes += p.KeyBytes
+		total.ValueBytes += p.ValueBytes
+	}
+
+	printPrefixStats(total)
+
+	return true
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/syndtr/goleveldb/leveldb"
+
+	cmdcommon "boscoin.io/sebak/cmd/sebak/common"
+	"boscoin.io/sebak/lib/block"
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/storage"
+	"boscoin.io/sebak/lib/transaction/operation"
+)
+
+// truncatePosition is the position of transaction in the removed blocks; the
+// proposer transaction is after the other transactions of block.
+type truncatePosition struct {
+	height uint64
+	index  int
+}
+
+func (p truncatePosition) before(o truncatePosition) bool {
+	if p.height != o.height {
+		return p.height < o.height
+	}
+
+	return p.index < o.index
+}
+
+// truncateReceipt is the amount received by the removed operation.
+type truncateReceipt struct {
+	position truncatePosition
+	amount   common.Amount
+}
+
+// Truncation collects the keys to be deleted and the accounts to be rolled
+// back to the height; all of them are written in one batch at the end, so the
+// storage is not changed if the truncation fails.
+type Truncation struct {
+	batch *leveldb.Batch
+	count int
+
+	// positions are the positions of the transactions in the removed blocks
+	// by hash.
+	positions map[string]truncatePosition
+	// proposerTxs are the proposer transactions of the removed blocks; their
+	// source is the proposer node, not the account.
+	proposerTxs map[string]bool
+	// sequenceIDs is the lowest sequence id of the removed transactions by
+	// source; it is the sequence id of account at the height.
+	sequenceIDs map[string]uint64
+	// firsts are the positions of the first removed transaction by source.
+	firsts map[string]truncatePosition
+	// touched are the accounts of the removed operations.
+	touched map[string]bool
+	// created are the accounts, which are created after the height.
+	created map[string]bool
+	// balances is the balance of the sequence id at the height from the
+	// `block-account-sequenceid` history.
+	balances map[string]common.Amount
+	// receipts are the amounts received by the removed operations by target.
+	receipts map[string][]truncateReceipt
+}
+
+func NewTruncation() *Truncation {
+	return &Truncation{
+		batch:       new(leveldb.Batch),
+		positions:   map[string]truncatePosition{},
+		proposerTxs: map[string]bool{},
+		sequenceIDs: map[string]uint64{},
+		firsts:      map[string]truncatePosition{},
+		touched:     map[string]bool{},
+		created:     map[string]bool{},
+		balances:    map[string]common.Amount{},
+		receipts:    map[string][]truncateReceipt{},
+	}
+}
+
+func parseFlagsTruncate(args []string) {
+	parseLogging(truncateCmd)
+
+	if !truncateCmd.Flags().Changed("height") {
+		cmdcommon.PrintFlagsError(truncateCmd, "--height", fmt.Errorf("must be given"))
+	} else if flagHeight < common.GenesisBlockHeight {
+		cmdcommon.PrintFlagsError(truncateCmd, "--height", fmt.Errorf("must not be lower than genesis block height"))
+	}
+
+	{ // check source
+		d, err := sourceDirectory(args[0])
+		if err != nil {
+			cmdcommon.PrintFlagsError(truncateCmd, "<db directory>", err)
+		}
+		flagSource = d
+
+		st, err := checkSourceDirectory(flagSource)
+		if err != nil {
+			cmdcommon.PrintFlagsError(truncateCmd, "<db directory>", err)
+		}
+		stLocal = st
+		source = &Source{st: st}
+	}
+
+	parsedFlags := []interface{}{}
+	parsedFlags = append(parsedFlags, "\n\tlog-level", logLevel)
+	parsedFlags = append(parsedFlags, "\n\tlog-format", flagLogFormat)
+	parsedFlags = append(parsedFlags, "\n\tlog", flagLog)
+	parsedFlags = append(parsedFlags, "\n\tsource", flagSource)
+	parsedFlags = append(parsedFlags, "\n\theight", flagHeight)
+	parsedFlags = append(parsedFlags, "\n\tdry-run", flagDryRun)
+	parsedFlags = append(parsedFlags, "\n", "")
+
+	log.Debug("parsed flags:", parsedFlags...)
+}
+
+// delete deletes the key; with `--dry-run`, the key is only printed.
+func (t *Truncation) delete(key []byte) error {
+	t.count += 1
+
+	if flagDryRun {
+		fmt.Printf("delete\t%s\n", keyString(key))
+		return nil
+	}
+
+	t.batch.Delete(key)
+
+	return nil
+}
+
+func (t *Truncation) write() error {
+	if flagDryRun || t.batch.Len() < 1 {
+		return nil
+	}
+
+	return stLocal.Core.Write(t.batch, nil)
+}
+
+// received returns the amount, which the target of operation receives.
+func received(bo block.BlockOperation) (common.Amount, error) {
+	switch bo.Type {
+	case operation.TypePayment, operation.TypeCollectTxFee, operation.TypeInflation, operation.TypeInflationPF:
+	default:
+		return 0, nil
+	}
+
+	body, err := operation.UnmarshalBodyJSON(bo.Type, bo.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	if bo.Type == operation.TypeInflationPF {
+		return body.(operation.InflationPF).GetAmount(), nil
+	}
+
+	return body.(operation.Payable).GetAmount(), nil
+}
+
+// removeBlock keeps the positions of the transactions and the proposer
+// transaction of the removed block.
+func (t *Truncation) removeBlock(item storage.IterItem) error {
+	var blk block.Block
+	if err := json.Unmarshal(item.Value, &blk); err != nil {
+		return err
+	}
+
+	for i, hash := range blk.Transactions {
+		t.positions[hash] = truncatePosition{height: blk.Height, index: i}
+	}
+
+	if len(blk.ProposerTransaction) > 0 {
+		t.positions[blk.ProposerTransaction] = truncatePosition{height: blk.Height, index: len(blk.Transactions)}
+		t.proposerTxs[blk.ProposerTransaction] = true
+	}
+
+	return nil
+}
+
+// removeRecord keeps the sources of the removed transactions and the accounts
+// of the removed operations with the received amounts. The proposer
+// transaction only touches the targets of it's operations.
+func (t *Truncation) removeRecord(prefix string, item storage.IterItem) error {
+	switch prefix {
+	case common.BlockTransactionPrefixHash:
+		var bt block.BlockTransaction
+		if err := json.Unmarshal(item.Value, &bt); err != nil {
+			return err
+		}
+		if t.proposerTxs[bt.Hash] {
+			return nil
+		}
+
+		if s, found := t.sequenceIDs[bt.Source]; !found || bt.SequenceID < s {
+			t.sequenceIDs[bt.Source] = bt.SequenceID
+		}
+		position := t.positions[bt.Hash]
+		if first, found := t.firsts[bt.Source]; !found || position.before(first) {
+			t.firsts[bt.Source] = position
+		}
+		t.touched[bt.Source] = true
+	case common.BlockOperationPrefixHash:
+		var bo block.BlockOperation
+		if err := json.Unmarshal(item.Value, &bo); err != nil {
+			return err
+		}
+		if !t.proposerTxs[bo.TxHash] {
+			t.touched[bo.Source] = true
+		}
+		if len(bo.Target) < 1 {
+			return nil
+		}
+
+		t.touched[bo.Target] = true
+		if bo.Type == operation.TypeCreateAccount {
+			t.created[bo.Target] = true
+			return nil
+		}
+
+		amount, err := received(bo)
+		if err != nil {
+			return err
+		} else if amount < 1 {
+			return nil
+		}
+		t.receipts[bo.Target] = append(
+			t.receipts[bo.Target],
+			truncateReceipt{position: t.positions[bo.TxHash], amount: amount},
+		)
+	}
+
+	return nil
+}
+
+// truncateBlocks deletes the blocks, transactions, operations and their
+// indexes after the height.
+func (t *Truncation) truncateBlocks() error {
+	hf, err := NewHeightFilter(flagHeight)
+	if err != nil {
+		return err
+	}
+
+	// the blocks are read first to find the proposer transactions
+	err = source.Walk(common.BlockPrefixHash, nil, func(item storage.IterItem) (bool, error) {
+		if !hf.Filter(common.BlockPrefixHash, item) {
+			return true, nil
+		}
+
+		if err := t.removeBlock(item); err != nil {
+			return false, fmt.Errorf("%s: %v", keyString(item.Key), err)
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, prefix := range allPrefixes {
+		if _, found := heightPrefixes[prefix]; !found {
+			continue
+		}
+
+		err := source.Walk(prefix, nil, func(item storage.IterItem) (bool, error) {
+			if !hf.Filter(prefix, item) {
+				return true, nil
+			}
+
+			if err := t.removeRecord(prefix, item); err != nil {
+				return false, fmt.Errorf("%s: %v", keyString(item.Key), err)
+			}
+
+			return true, t.delete(item.Key)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sequenceID returns the sequence id of the account at the height.
+func (t *Truncation) sequenceID(address string) (uint64, error) {
+	if s, found := t.sequenceIDs[address]; found {
+		return s, nil
+	}
+
+	b, err := source.Get(fmt.Sprintf("%s%s", common.BlockAccountPrefixAddress, address))
+	if err != nil {
+		return 0, err
+	}
+
+	var ac block.BlockAccount
+	if err := json.Unmarshal(b, &ac); err != nil {
+		return 0, err
+	}
+	t.sequenceIDs[address] = ac.SequenceID
+
+	return ac.SequenceID, nil
+}
+
+// truncateSequenceIDs deletes the sequence id history after the height and
+// finds the balance of the sequence id at the height.
+func (t *Truncation) truncateSequenceIDs() error {
+	for _, prefix := range []string{common.BlockAccountSequenceIDPrefix, common.BlockAccountSequenceIDByAddressPrefix} {
+		err := source.Walk(prefix, nil, func(item storage.IterItem) (bool, error) {
+			var bas block.BlockAccountSequenceID
+			if err := json.Unmarshal(item.Value, &bas); err != nil {
+				return false, fmt.Errorf("%s: %v", keyString(item.Key), err)
+			}
+
+			if !t.touched[bas.Address] {
+				return true, nil
+			} else if t.created[bas.Address] {
+				return true, t.delete(item.Key)
+			}
+
+			s, err := t.sequenceID(bas.Address)
+			if err != nil {
+				return false, fmt.Errorf("%s: %v", bas.Address, err)
+			}
+
+			if bas.SequenceID > s {
+				return true, t.delete(item.Key)
+			} else if bas.SequenceID == s {
+				t.balances[bas.Address] = bas.Balance
+			}
+
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// balance returns the balance of account at the height. The balance of the
+// source of the removed transactions is restored from the sequence id history,
+// which already has the amounts received before it's first removed
+// transaction; for the other accounts, the amounts received by the removed
+// operations are subtracted from the current balance.
+func (t *Truncation) balance(ac block.BlockAccount) (common.Amount, error) {
+	balance := ac.Balance
+	first, isSource := t.firsts[ac.Address]
+	if isSource {
+		b, found := t.balances[ac.Address]
+		if !found {
+			return 0, fmt.Errorf("balance of sequence id, %d not found in history", t.sequenceIDs[ac.Address])
+		}
+		balance = b
+	}
+
+	for _, r := range t.receipts[ac.Address] {
+		if isSource && !r.position.before(first) {
+			continue
+		}
+
+		var err error
+		if balance, err = balance.Sub(r.amount); err != nil {
+			return 0, fmt.Errorf("insufficient balance to be rolled back: %v", err)
+		}
+	}
+
+	return balance, nil
+}
+
+// truncateAccounts deletes the accounts, which are created after the height
+// and rolls back the sequence id and balance of the other touched accounts.
+func (t *Truncation) truncateAccounts() error {
+	err := source.Walk(common.BlockAccountPrefixCreated, nil, func(item storage.IterItem) (bool, error) {
+		var address string
+		if err := json.Unmarshal(item.Value, &address); err != nil {
+			return false, fmt.Errorf("%s: %v", keyString(item.Key), err)
+		}
+
+		if !t.created[address] {
+			return true, nil
+		}
+
+		return true, t.delete(item.Key)
+	})
+	if err != nil {
+		return err
+	}
+
+	var addresses []string
+	for address := range t.touched {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	for _, address := range addresses {
+		key := []byte(fmt.Sprintf("%s%s", common.BlockAccountPrefixAddress, address))
+		if t.created[address] {
+			if err := t.delete(key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		b, err := source.Get(string(key))
+		if err != nil {
+			return fmt.Errorf("%s: %v", address, err)
+		}
+
+		var ac block.BlockAccount
+		if err := json.Unmarshal(b, &ac); err != nil {
+			return fmt.Errorf("%s: %v", address, err)
+		}
+
+		balance, err := t.balance(ac)
+		if err != nil {
+			return fmt.Errorf("%s: %v", address, err)
+		}
+
+		if ac.SequenceID == t.sequenceIDs[address] && ac.Balance == balance {
+			continue
+		}
+
+		if flagDryRun {
+			fmt.Printf(
+				"account\t%s\tsequence-id=%d->%d balance=%s->%s\n",
+				address,
+				ac.SequenceID,
+				t.sequenceIDs[address],
+				ac.Balance,
+				balance,
+			)
+			continue
+		}
+
+		ac.SequenceID = t.sequenceIDs[address]
+		ac.Balance = balance
+		if b, err = json.Marshal(ac); err != nil {
+			return err
+		}
+		t.batch.Put(key, b)
+	}
+
+	return nil
+}
+
+func truncate() bool {
+	defer func() {
+		source.Close()
+	}()
+
+	// the deleted keys are read from the snapshot
+	if err := source.OpenSnapshot(); err != nil {
+		log.Error("failed to open snapshot", "error", err)
+		return false
+	}
+
+	t := NewTruncation()
+	if err := t.truncateBlocks(); err != nil {
+		log.Error("failed to truncate blocks", "error", err)
+		return false
+	}
+	log.Debug("blocks truncated", "deleted", t.count, "accounts", len(t.touched))
+
+	if err := t.truncateSequenceIDs(); err != nil {
+		log.Error("failed to truncate sequence ids", "error", err)
+		return false
+	}
+
+	if err := t.truncateAccounts(); err != nil {
+		log.Error("failed to truncate accounts", "error", err)
+		return false
+	}
+
+	if err := t.write(); err != nil {
+		log.Error("failed to write", "error", err)
+		return false
+	}
+
+	log.Info(
+		"truncated",
+		"height", flagHeight,
+		"deleted", t.count,
+		"accounts", len(t.touched),
+		"removed-accounts", len(t.created),
+		"dry-run", flagDryRun,
+	)
+
+	return true
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"boscoin.io/sebak/lib/block"
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/storage"
+)
+
+func newTestStorage(t *testing.T, directory string) *storage.LevelDBBackend {
+	storageConfig, err := storage.NewConfigFromString("file://" + directory)
+	require.NoError(t, err)
+
+	st, err := storage.NewStorage(storageConfig)
+	require.NoError(t, err)
+
+	return st
+}
+
+// generateTestStorage generates the blocks up to the height with the fixed
+// seed; it returns the directory of storage.
+func generateTestStorage(t *testing.T, height uint64) string {
+	directory, err := ioutil.TempDir("", "sebak-storage-truncate")
+	require.NoError(t, err)
+
+	st := newTestStorage(t, directory)
+	defer st.Close()
+
+	mix, err := parseOperationMix("payment:50,create-account:20,freezing:15,unfreezing:15")
+	require.NoError(t, err)
+
+	g, err := NewGenerator(st, 7, []byte("sebak-test-network"), mix)
+	require.NoError(t, err)
+	require.NoError(t, g.genesis())
+
+	for g.latest.Height < height {
+		require.NoError(t, g.next())
+	}
+
+	return directory
+}
+
+// testAccounts returns the accounts of storage by address.
+func testAccounts(t *testing.T, directory string) (uint64, map[string]block.BlockAccount) {
+	st := newTestStorage(t, directory)
+	defer st.Close()
+
+	accounts := map[string]block.BlockAccount{}
+	err := (&Source{st: st}).Walk(common.BlockAccountPrefixAddress, nil, func(item storage.IterItem) (bool, error) {
+		var ac block.BlockAccount
+		if err := json.Unmarshal(item.Value, &ac); err != nil {
+			return false, err
+		}
+		accounts[ac.Address] = ac
+
+		return true, nil
+	})
+	require.NoError(t, err)
+
+	return block.GetLatestBlock(st).Height, accounts
+}
+
+// TestTruncateGenerated truncates the generated storage and compares it with
+// the storage generated only up to the height by the same seed.
+func TestTruncateGenerated(t *testing.T) {
+	defer func(period uint64) {
+		flagUnfreezingPeriod = period
+	}(flagUnfreezingPeriod)
+	flagUnfreezingPeriod = 3
+
+	var height uint64 = 20
+
+	expected := generateTestStorage(t, height)
+	defer os.RemoveAll(expected)
+
+	truncated := generateTestStorage(t, height+20)
+	defer os.RemoveAll(truncated)
+
+	flagHeight = height
+	flagDryRun = false
+	stLocal = newTestStorage(t, truncated)
+	source = &Source{st: stLocal}
+	require.True(t, truncate())
+
+	expectedHeight, expectedAccounts := testAccounts(t, expected)
+	truncatedHeight, truncatedAccounts := testAccounts(t, truncated)
+
+	require.Equal(t, expectedHeight, truncatedHeight)
+	require.Equal(t, len(expectedAccounts), len(truncatedAccounts))
+	for address, ac := range expectedAccounts {
+		tac, found := truncatedAccounts[address]
+		require.True(t, found, address)
+		require.Equal(t, ac.Balance, tac.Balance, address)
+		require.Equal(t, ac.SequenceID, tac.SequenceID, address)
+		require.Equal(t, ac.Linked, tac.Linked, address)
+	}
+}
@@ -4,14 +4,13 @@ import (
 	"bytes"
 	"compress/flate"
 	"compress/gzip"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	jsonrpc "github.com/gorilla/rpc/json"
 	logging "github.com/inconshreveable/log15"
@@ -33,7 +32,7 @@ func parseLogging(cmd *cobra.Command) {
 	var logFormatter logging.Format
 	switch flagLogFormat {
 	case "terminal":
-		if isatty.IsTerminal(os.Stdout.Fd()) && len(flagLog) < 1 {
+		if isatty.IsTerminal(logStream.Fd()) && len(flagLog) < 1 {
 			logFormatter = logging.TerminalFormat()
 		} else {
 			logFormatter = logging.LogfmtFormat()
@@ -44,7 +43,7 @@ func parseLogging(cmd *cobra.Command) {
 		cmdcommon.PrintFlagsError(cmd, "--log-format", fmt.Errorf("'%s'", flagLogFormat))
 	}
 
-	logHandler := logging.StreamHandler(os.Stdout, logFormatter)
+	logHandler := logging.StreamHandler(logStream, logFormatter)
 	if len(flagLog) > 0 {
 		if logHandler, err = logging.FileHandler(flagLog, logFormatter); err != nil {
 			cmdcommon.PrintFlagsError(cmd, "--log", err)
@@ -57,55 +56,36 @@ func parseLogging(cmd *cobra.Command) {
 }
 
 func checkSource(s string) error {
-	log.Debug("checking source", "source", s)
-
-	u, err := url.Parse(s)
+	src, err := NewSource(s)
 	if err != nil {
 		return err
 	}
 
-	switch strings.ToLower(u.Scheme) {
-	case "http", "https":
-		log.Debug("source is jsonrpc-based", "parsed", u)
-		if err := checkSourceJSONRpc(s); err != nil {
-			log.Error("failed to check jsonrpc endpoint", "error", err)
-			return err
-		}
-	default:
-		log.Debug("source is file-based", "parsed", u)
-		if st, err := checkSourceDirectory(s); err != nil {
-			log.Error("failed to check file-based source", "error", err)
-			return err
-		} else {
-			stSource = st
-		}
-	}
+	source = src
 
 	return nil
 }
 
-func checkSourceJSONRpc(s string) error {
+func checkSourceJSONRpc(s string) (*common.Endpoint, error) {
 	endpoint, err := common.ParseEndpoint(s)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	jsonRPCEndpoint = endpoint
-
 	args := runner.DBEchoArgs(common.NowISO8601())
-	resp, err := request("DB.Echo", &args)
+	resp, err := request(endpoint, "DB.Echo", &args)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer resp.Body.Close()
 
 	var result runner.DBEchoResult
 	if err := jsonrpc.DecodeClientResponse(resp.Body, &result); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return endpoint, nil
 }
 
 func currentDirectory() (string, error) {
@@ -119,12 +99,34 @@ func currentDirectory() (string, error) {
 }
 
 func checkSourceDirectory(s string) (*storage.LevelDBBackend, error) {
+	source, err := sourceDirectory(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if storageConfig, err := storage.NewConfigFromString("file://" + source); err != nil {
+		return nil, err
+	} else {
+		if st, err := storage.NewStorage(storageConfig); err != nil {
+			if errno, ok := err.(syscall.Errno); ok && errno == syscall.EWOULDBLOCK {
+				return nil, fmt.Errorf("storage, `%s` is locked; the node may be running, use jsonrpc instead", source)
+			}
+			return nil, err
+		} else {
+			return st, nil
+		}
+	}
+}
+
+// sourceDirectory returns the absolute path of local storage; it must not be
+// empty.
+func sourceDirectory(s string) (string, error) {
 	var source string
 	if strings.HasPrefix(s, "file://") {
 		source = s[7:]
 	} else if !strings.HasPrefix(s, "/") {
 		if c, err := currentDirectory(); err != nil {
-			return nil, err
+			return "", err
 		} else {
 			source = c + "/" + s
 		}
@@ -133,37 +135,45 @@ func checkSourceDirectory(s string) (*storage.LevelDBBackend, error) {
 	}
 
 	if _, err := os.Stat(source); os.IsNotExist(err) {
-		return nil, err
+		return "", err
 	} else {
 		d, err := os.Open(source)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 		defer d.Close()
 
 		if _, err = d.Readdirnames(1); err == io.EOF {
-			return nil, fmt.Errorf("db source source, `%source` is empty", source)
+			return "", fmt.Errorf("db source source, `%source` is empty", source)
 		}
 	}
 
-	if storageConfig, err := storage.NewConfigFromString("file://" + source); err != nil {
-		return nil, err
-	} else {
-		if st, err := storage.NewStorage(storageConfig); err != nil {
-			return nil, err
-		} else {
-			return st, nil
+	return source, nil
+}
+
+// directorySize returns the total size of the files in directory.
+func directorySize(directory string) (int64, error) {
+	var size int64
+	err := filepath.Walk(directory, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
 		}
-	}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, err
 }
 
-func request(method string, args interface{}) (*http.Response, error) {
+func request(endpoint *common.Endpoint, method string, args interface{}) (*http.Response, error) {
 	message, err := jsonrpc.EncodeClientRequest(method, &args)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", jsonRPCEndpoint.String(), bytes.NewBuffer(message))
+	req, err := http.NewRequest("POST", endpoint.String(), bytes.NewBuffer(message))
 	if err != nil {
 		return nil, err
 	}
@@ -182,6 +192,20 @@ func request(method string, args interface{}) (*http.Response, error) {
 	return resp, nil
 }
 
+// keyString returns the readable key; the prefix is replaced by it's name.
+func keyString(key []byte) string {
+	if len(key) < 1 {
+		return ""
+	}
+
+	name, found := allPrefixesWithName[string(key[:1])]
+	if !found {
+		return string(key)
+	}
+
+	return fmt.Sprintf("%s:%s", name, string(key[1:]))
+}
+
 func shortLogValue(s []byte) []byte {
 	if len(s) < 10 {
 		return s
@@ -190,23 +214,15 @@ func shortLogValue(s []byte) []byte {
 	return s[:10]
 }
 
+// GzipWriter compresses the data into the underlying writer.
 type GzipWriter struct {
-	f  *os.File
+	w  io.WriteCloser
 	gw *gzip.Writer
 }
 
-func NewGzipWriter(name string) (*GzipWriter, error) {
-	f, err := os.OpenFile(
-		name+".gz",
-		os.O_CREATE|os.O_WRONLY,
-		0644,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	gw, _ := gzip.NewWriterLevel(f, flate.BestSpeed)
-	return &GzipWriter{f: f, gw: gw}, nil
+func NewGzipWriter(w io.WriteCloser) *GzipWriter {
+	gw, _ := gzip.NewWriterLevel(w, flate.BestSpeed)
+	return &GzipWriter{w: w, gw: gw}
 }
 
 func (g *GzipWriter) Write(b []byte) (int, error) {
@@ -222,7 +238,7 @@ func (g *GzipWriter) Close() error {
 		return err
 	}
 
-	if err := g.f.Close(); err != nil {
+	if err := g.w.Close(); err != nil {
 		return err
 	}
 
@@ -244,31 +260,45 @@ func (i *ListFlags) Set(value string) error {
 	return nil
 }
 
-func saveItemToOutput(cmd *cobra.Command, prefix string, item storage.IterItem) error {
-	if stOutput != nil {
-		return stOutput.Core.Put(item.Key, item.Value, nil)
+// closeOutput flushes and closes the output of dump.
+func closeOutput() {
+	if outputSink == nil {
+		return
 	}
 
-	if jsonFiles != nil {
-		var err error
-		var f *GzipWriter
-		l, found := jsonFiles.Load(prefix)
-		if found {
-			f = l.(*GzipWriter)
-		} else {
-			f, err = NewGzipWriter(filepath.Join(flagOutput, allPrefixesWithName[prefix]) + ".json")
-			if err != nil {
-				cmdcommon.PrintError(cmd, fmt.Errorf("failed to create GzipWriter: %v", err))
-			}
-			jsonFiles.Store(prefix, f)
+	if err := outputSink.Close(); err != nil {
+		log.Error("failed to close output", "error", err)
+	}
+	outputSink = nil
+}
+
+// parseFlagPrefix checks `--prefix`; without `--prefix`, all prefixes are
+// selected.
+func parseFlagPrefix(cmd *cobra.Command) {
+	if len(flagPrefix) < 1 {
+		flagPrefix = append(flagPrefix, "all")
+	}
+
+	var all bool
+	for _, prefix := range flagPrefix {
+		if prefix == "all" {
+			all = true
+			continue
 		}
 
-		var b []byte
-		if b, err = json.Marshal(item); err != nil {
-			cmdcommon.PrintError(cmd, fmt.Errorf("failed to marshal storage.Item: %v", err))
+		if _, found := allPrefixesByName[prefix]; !found {
+			cmdcommon.PrintFlagsError(cmd, "--prefix", fmt.Errorf("unknown prefix found: %v", prefix))
 		}
-		f.Write(append(b, []byte("\n")...))
 	}
 
-	return nil
+	if all {
+		flagPrefix = ListFlags{}
+		for _, prefix := range allPrefixes {
+			flagPrefix = append(flagPrefix, allPrefixesWithName[prefix])
+		}
+	}
+}
+
+func saveItemToOutput(prefix string, item storage.IterItem) error {
+	return outputSink.Write(prefix, item)
 }
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	cmdcommon "boscoin.io/sebak/cmd/sebak/common"
+	"boscoin.io/sebak/lib/block"
+	"boscoin.io/sebak/lib/common"
+	"boscoin.io/sebak/lib/storage"
+)
+
+// indexPrefixes are the index prefixes and the primary prefixes, which their
+// values point to.
+var indexPrefixes map[string]string = map[string]string{
+	common.BlockPrefixConfirmed:             common.BlockPrefixHash,
+	common.BlockPrefixHeight:                common.BlockPrefixHash,
+	common.BlockTransactionPrefixSource:     common.BlockTransactionPrefixHash,
+	common.BlockTransactionPrefixConfirmed:  common.BlockTransactionPrefixHash,
+	common.BlockTransactionPrefixAccount:    common.BlockTransactionPrefixHash,
+	common.BlockTransactionPrefixBlock:      common.BlockTransactionPrefixHash,
+	common.BlockOperationPrefixTxHash:       common.BlockOperationPrefixHash,
+	common.BlockOperationPrefixSource:       common.BlockOperationPrefixHash,
+	common.BlockOperationPrefixTarget:       common.BlockOperationPrefixHash,
+	common.BlockOperationPrefixPeers:        common.BlockOperationPrefixHash,
+	common.BlockOperationPrefixTypeSource:   common.BlockOperationPrefixHash,
+	common.BlockOperationPrefixTypeTarget:   common.BlockOperationPrefixHash,
+	common.BlockOperationPrefixTypePeers:    common.BlockOperationPrefixHash,
+	common.BlockOperationPrefixCreateFrozen: common.BlockOperationPrefixHash,
+	common.BlockOperationPrefixFrozenLinked: common.BlockOperationPrefixHash,
+	common.BlockOperationPrefixBlockHeight:  common.BlockOperationPrefixHash,
+	common.BlockAccountPrefixCreated:        common.BlockAccountPrefixAddress,
+}
+
+var verifyProblems map[string]int = map[string]int{}
+
+func parseFlagsVerify(args []string) {
+	parseLogging(verifyCmd)
+
+	{ // check source
+		flagSource = args[0]
+		if err := checkSource(flagSource); err != nil {
+			cmdcommon.PrintFlagsError(verifyCmd, "<source>", err)
+		}
+	}
+
+	parsedFlags := []interface{}{}
+	parsedFlags = append(parsedFlags, "\n\tlog-level", logLevel)
+	parsedFlags = append(parsedFlags, "\n\tlog-format", flagLogFormat)
+	parsedFlags = append(parsedFlags, "\n\tlog", flagLog)
+	parsedFlags = append(parsedFlags, "\n\tsource", flagSource)
+	parsedFlags = append(parsedFlags, "\n", "")
+
+	log.Debug("parsed flags:", parsedFlags...)
+}
+
+func reportProblem(kind string, key []byte, detail string) {
+	verifyProblems[kind] += 1
+	fmt.Printf("%s\t%s\t%s\n", kind, keyString(key), detail)
+}
+
+// verifyBlocks walks `block-height` and checks the blocks, transactions and
+// operations of each block are stored.
+func verifyBlocks() error {
+	var count int
+	err := source.Walk(common.BlockPrefixHeight, nil, func(item storage.IterItem) (bool, error) {
+		count += 1
+		if count%10000 == 0 {
+			log.Debug("blocks verified", "count", count)
+		}
+
+		var hash string
+		if err := json.Unmarshal(item.Value, &hash); err != nil {
+			reportProblem("invalid-value", item.Key, err.Error())
+			return true, nil
+		}
+
+		key := fmt.Sprintf("%s%s", common.BlockPrefixHash, hash)
+		b, err := source.Get(key)
+		if err != nil {
+			if found, e := source.Has(key); e != nil {
+				return false, e
+			} else if !found {
+				reportProblem("dangling-index", item.Key, hash)
+				return true, nil
+			}
+			return false, err
+		}
+
+		var blk block.Block
+		if err := json.Unmarshal(b, &blk); err != nil {
+			reportProblem("invalid-value", []byte(key), err.Error())
+			return true, nil
+		}
+
+		height, err := strconv.ParseUint(string(item.Key[len(common.BlockPrefixHeight):]), 10, 64)
+		if err != nil || height != blk.Height {
+			reportProblem("height-mismatch", item.Key, fmt.Sprintf("block height=%d", blk.Height))
+		}
+
+		hashes := blk.Transactions
+		if len(blk.ProposerTransaction) > 0 {
+			hashes = append(hashes, blk.ProposerTransaction)
+		}
+
+		for _, h := range hashes {
+			if err := verifyTransaction(blk, h); err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Debug("blocks verified", "count", count)
+
+	return nil
+}
+
+func verifyTransaction(blk block.Block, hash string) error {
+	key := fmt.Sprintf("%s%s", common.BlockTransactionPrefixHash, hash)
+	b, err := source.Get(key)
+	if err != nil {
+		if found, e := source.Has(key); e != nil {
+			return e
+		} else if !found {
+			reportProblem("missing-transaction", []byte(key), fmt.Sprintf("block=%s height=%d", blk.Hash, blk.Height))
+			return nil
+		}
+		return err
+	}
+
+	var bt block.BlockTransaction
+	if err := json.Unmarshal(b, &bt); err != nil {
+		reportProblem("invalid-value", []byte(key), err.Error())
+		return nil
+	}
+
+	for _, o := range bt.Operations {
+		opKey := fmt.Sprintf("%s%s", common.BlockOperationPrefixHash, o)
+		if found, err := source.Has(opKey); err != nil {
+			return err
+		} else if !found {
+			reportProblem("missing-operation", []byte(opKey), fmt.Sprintf("transaction=%s", hash))
+		}
+	}
+
+	return nil
+}
+
+// verifyOperations checks the transaction of each operation is stored.
+func verifyOperations() error {
+	return source.Walk(common.BlockOperationPrefixHash, nil, func(item storage.IterItem) (bool, error) {
+		var bo block.BlockOperation
+		if err := json.Unmarshal(item.Value, &bo); err != nil {
+			reportProblem("invalid-value", item.Key, err.Error())
+			return true, nil
+		}
+
+		key := fmt.Sprintf("%s%s", common.BlockTransactionPrefixHash, bo.TxHash)
+		if found, err := source.Has(key); err != nil {
+			return false, err
+		} else if !found {
+			reportProblem("orphan-operation", item.Key, fmt.Sprintf("transaction=%s", bo.TxHash))
+		}
+
+		return true, nil
+	})
+}
+
+// verifyIndex checks the values of index prefix point to the stored records.
+func verifyIndex(prefix string) error {
+	primary := indexPrefixes[prefix]
+
+	return source.Walk(prefix, nil, func(item storage.IterItem) (bool, error) {
+		var hash string
+		if err := json.Unmarshal(item.Value, &hash); err != nil {
+			reportProblem("invalid-value", item.Key, err.Error())
+			return true, nil
+		}
+
+		if found, err := source.Has(fmt.Sprintf("%s%s", primary, hash)); err != nil {
+			return false, err
+		} else if !found {
+			reportProblem("dangling-index", item.Key, hash)
+		}
+
+		return true, nil
+	})
+}
+
+// verifyAccounts checks the `SequenceID` of each account is same with the
+// latest one in `block-account-sequenceid`.
+func verifyAccounts() error {
+	return source.Walk(common.BlockAccountPrefixAddress, nil, func(item storage.IterItem) (bool, error) {
+		var ac block.BlockAccount
+		if err := json.Unmarshal(item.Value, &ac); err != nil {
+			reportProblem("invalid-value", item.Key, err.Error())
+			return true, nil
+		}
+
+		items, err := source.GetIterator(
+			fmt.Sprintf("%s%s-", common.BlockAccountSequenceIDPrefix, ac.Address),
+			nil,
+			true,
+			1,
+		)
+		if err != nil {
+			return false, err
+		} else if len(items) < 1 {
+			reportProblem("missing-sequenceid", item.Key, fmt.Sprintf("sequenceid=%d", ac.SequenceID))
+			return true, nil
+		}
+
+		var bas block.BlockAccountSequenceID
+		if err := json.Unmarshal(items[0].Value, &bas); err != nil {
+			reportProblem("invalid-value", items[0].Key, err.Error())
+			return true, nil
+		}
+
+		if bas.SequenceID != ac.SequenceID {
+			reportProblem(
+				"sequenceid-mismatch",
+				item.Key,
+				fmt.Sprintf("account=%d block-account-sequenceid=%d", ac.SequenceID, bas.SequenceID),
+			)
+		}
+
+		return true, nil
+	})
+}
+
+// verify returns false when the problems are found.
+func verify() bool {
+	defer func() {
+		if source != nil {
+			source.Close()
+		}
+	}()
+
+	if err := source.OpenSnapshot(); err != nil {
+		log.Error("failed to OpenSnapshot", "error", err)
+		return false
+	}
+
+	steps := []struct {
+		name string
+		f    func() error
+	}{
+		{"blocks", verifyBlocks},
+		{"operations", verifyOperations},
+		{"accounts", verifyAccounts},
+	}
+
+	var prefixes []string
+	for prefix := range indexPrefixes {
+		if prefix == common.BlockPrefixHeight { // already checked by verifyBlocks
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		p := prefix
+		steps = append(steps, struct {
+			name string
+			f    func() error
+		}{allPrefixesWithName[p], func() error { return verifyIndex(p) }})
+	}
+
+	for _, step := range steps {
+		log.Debug("verifying", "step", step.name)
+		if err := step.f(); err != nil {
+			log.Error("failed to verify", "step", step.name, "error", err)
+			return false
+		}
+		log.Debug("verified", "step", step.name)
+	}
+
+	if len(verifyProblems) < 1 {
+		log.Info("no problem found")
+		return true
+	}
+
+	var problems []string
+	for kind, count := range verifyProblems {
+		problems = append(problems, fmt.Sprintf("%s=%d", kind, count))
+	}
+	sort.Strings(problems)
+	log.Error("problems found", "problems", strings.Join(problems, " "))
+
+	return false
+}